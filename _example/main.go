@@ -17,174 +17,51 @@ package main
 import (
 	"bytes"
 	"embed"
-	_ "embed"
 	"image"
 	"image/color"
 	"log"
-	"math"
-	"time"
 
-	"golang.org/x/text/language"
-
-	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
-	"github.com/hajimehoshi/ebiten/v2/text/v2"
-	"github.com/hajimehoshi/ebiten/v2/vector"
-	"github.com/kijimaD/nova/event"
-	"github.com/kijimaD/nova/lexer"
-	"github.com/kijimaD/nova/parser"
-)
-
-const (
-	screenWidth  = 720
-	screenHeight = 720
-	fontSize     = 26
-	padding      = 40
+	"github.com/kijimaD/nova/loader"
+	"github.com/kijimaD/nova/renderer"
 )
 
-var japaneseFaceSource *text.GoTextFaceSource
-var eventQ event.Queue
-
 //go:embed input.sce
 var input []byte
 
 //go:embed file
 var FS embed.FS
 
-type Game struct {
-	bgImage     *ebiten.Image
-	promptImage *ebiten.Image
-	startTime   time.Time
-}
-
-func (g *Game) Update() error {
-	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
-		eventQ.Run()
-	}
-
-	select {
-	case v := <-eventQ.NotifyChan:
-		switch event := v.(type) {
-		case *event.ChangeBg:
-			eimg, err := loadImage(event.Source)
-			if err != nil {
-				log.Fatal(err)
-			}
-			g.bgImage = eimg
-		}
-	default:
-	}
-
-	return nil
-}
-
-func (g *Game) Draw(screen *ebiten.Image) {
-	{
-		// 背景画像
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Translate(0, screenHeight/4)
-		screen.DrawImage(g.bgImage, op)
-	}
-
-	{
-		// 背景色
-		black := color.RGBA{0x00, 0x00, 0x00, 0x80}
-		vector.DrawFilledRect(screen, 0, 0, screenWidth, screenHeight, black, false)
-	}
-
-	f := &text.GoTextFace{
-		Source:   japaneseFaceSource,
-		Size:     fontSize,
-		Language: language.Japanese,
-	}
-
-	// 待ち状態表示
-	if eventQ.OnAnim {
-		elapsed := time.Since(g.startTime).Seconds()
-		offsetY := 4 * math.Sin(elapsed*4) // sin関数で上下に動かす
-		bounds := g.promptImage.Bounds()
-		bounds.Min.Y = int(20 + offsetY) // 初期位置 + オフセット
-		bounds.Max.Y = bounds.Min.Y + bounds.Dy()
-
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Translate(720-float64(bounds.Max.X*2), 720-float64(bounds.Min.Y*2))
-		screen.DrawImage(g.promptImage, op)
-	}
-
-	{
-		japaneseText := eventQ.Display()
-		const lineSpacing = fontSize + 4
-		x, y := padding, padding
-		op := &text.DrawOptions{}
-		op.GeoM.Translate(float64(x), float64(y))
-		op.LineSpacing = lineSpacing
-		text.Draw(screen, japaneseText, f, op)
-	}
-}
-
-func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
-}
-
 func main() {
-	game := &Game{startTime: time.Now()}
-	{
-		font, err := FS.ReadFile("file/JF-Dot-Kappa20B.ttf")
-		if err != nil {
-			log.Fatal(err)
-		}
-		s, err := text.NewGoTextFaceSource(bytes.NewReader(font))
-		if err != nil {
-			log.Fatal(err)
-		}
-		japaneseFaceSource = s
-	}
-
-	l := lexer.NewLexer(string(input))
-	p := parser.NewParser(l)
-	program, err := p.ParseProgram()
+	q, err := loader.NewQueueFromReader(bytes.NewReader(input))
 	if err != nil {
 		log.Fatal(err)
 	}
-	e := event.NewEvaluator()
-	e.Eval(program)
-	eventQ = event.NewQueue(e)
-	eventQ.Start()
-
-	{
-		eimg, err := loadImage("file/black.png")
-		if err != nil {
-			log.Fatal(err)
-		}
-		game.bgImage = eimg
-	}
-	{
-		eimg, err := loadImage("file/prompt.png")
-		if err != nil {
-			log.Fatal(err)
-		}
-		game.promptImage = eimg
-	}
 
-	ebiten.SetWindowSize(screenWidth, screenHeight)
-	ebiten.SetWindowTitle("demo")
-	if err := ebiten.RunGame(game); err != nil {
+	opts := renderer.DefaultOptions()
+	// 画面全体に本文を表示する
+	opts.Layout.Window = image.Rect(0, 0, opts.Layout.ScreenWidth, opts.Layout.ScreenHeight)
+	opts.Layout.WindowColor = color.RGBA{0x00, 0x00, 0x00, 0x80}
+	opts.Layout.Padding = 40
+	opts.Layout.NameBox = image.Rectangle{}
+	opts.Layout.LineSpacing = 40
+	opts.Font, err = renderer.LoadFont(FS, "file/JF-Dot-Kappa20B.ttf")
+	if err != nil {
 		log.Fatal(err)
 	}
-}
-
-func loadImage(filename string) (*ebiten.Image, error) {
-	bs, err := FS.ReadFile(filename)
+	opts.Images, err = renderer.LoadImages(FS, q.Evaluator)
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
-	dec, _, err := image.Decode(bytes.NewReader(bs))
+	opts.Prompt, err = renderer.LoadImage(FS, "file/prompt.png")
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
-	img := ebiten.NewImageFromImage(dec)
+
+	g, err := renderer.NewGame(q, opts)
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
+	}
+	if err := g.Run("demo"); err != nil {
+		log.Fatal(err)
 	}
-	return img, nil
 }
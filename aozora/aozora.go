@@ -0,0 +1,226 @@
+// 青空文庫形式のテキストを、シナリオファイルに変換するパッケージ
+package aozora
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/format"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+)
+
+var (
+	// ［＃...］形式の注記
+	annotationRe = regexp.MustCompile(`［＃[^］]*］`)
+	// 見出しの注記
+	headingRe = regexp.MustCompile(`［＃(「[^」]*」は)?(大|中|小)見出し］`)
+	// 改ページの注記
+	pageBreakRe = regexp.MustCompile(`［＃改(ページ|丁|段|見開き)］`)
+	// 底本などの情報の開始
+	footerPrefix = "底本："
+	// 記号の説明の区切り線
+	separatorPrefix = "-------"
+)
+
+// 青空文庫形式のテキストをシナリオに変換する
+// 表題と著者はstartラベルに、見出しと改ページはラベルに、段落は[p]区切りに変換する
+func Convert(w io.Writer, r io.Reader) error {
+	doc, err := read(r)
+	if err != nil {
+		return err
+	}
+
+	c := converter{w: w}
+	c.label("start")
+	c.text(strings.Join(doc.header, "[r]"))
+	c.page()
+	for _, line := range doc.body {
+		c.line(line)
+	}
+
+	return c.err
+}
+
+// 変換したシナリオをパースしてASTを返す
+func ConvertProgram(r io.Reader) (*ast.Program, error) {
+	var b strings.Builder
+	if err := Convert(&b, r); err != nil {
+		return nil, err
+	}
+	l := lexer.NewLexer(b.String())
+	p := parser.NewParser(l)
+
+	return p.ParseProgram()
+}
+
+// 表題などの情報と本文に分けたテキスト
+type document struct {
+	// 表題・著者など、本文の前にある行
+	header []string
+	// 本文の行
+	body []string
+}
+
+// 表題部、記号の説明、本文、底本の情報に分けて読み込む
+func read(r io.Reader) (document, error) {
+	doc := document{header: []string{}, body: []string{}}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	inHeader := true
+	inNotation := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, footerPrefix):
+			return doc, nil
+		case strings.HasPrefix(line, separatorPrefix):
+			inHeader = false
+			inNotation = !inNotation
+		case inNotation:
+		case inHeader && line == "":
+			inHeader = false
+		case inHeader:
+			doc.header = append(doc.header, convertRuby(format.EscapeText(line, false)))
+		default:
+			doc.body = append(doc.body, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return doc, err
+	}
+
+	return doc, nil
+}
+
+// シナリオを書き出す
+type converter struct {
+	w   io.Writer
+	err error
+	// ラベルの数
+	labels int
+	// 現在のラベルに本文を書いたか
+	written bool
+}
+
+// 本文の1行を変換する
+func (c *converter) line(line string) {
+	if pageBreakRe.MatchString(line) {
+		c.section()
+	}
+	if headingRe.MatchString(line) {
+		c.section()
+		heading := strings.TrimFunc(annotationRe.ReplaceAllString(line, ""), unicode.IsSpace)
+		if heading != "" {
+			c.text(convertRuby(format.EscapeText(heading, true)))
+			c.page()
+		}
+		return
+	}
+
+	text := strings.TrimRightFunc(annotationRe.ReplaceAllString(line, ""), unicode.IsSpace)
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	c.text(convertRuby(format.EscapeText(text, true)))
+	c.page()
+}
+
+// 新しいラベルを開始する。前のラベルの末尾からジャンプする
+// 本文を書いていないラベルのときは何もしない
+func (c *converter) section() {
+	if !c.written {
+		return
+	}
+	name := fmt.Sprintf("ch%d", c.labels)
+	c.printf("[jump target=\"%s\"]\n\n", name)
+	c.label(name)
+}
+
+func (c *converter) label(name string) {
+	c.printf("*%s\n", name)
+	c.labels++
+	c.written = false
+}
+
+func (c *converter) text(s string) {
+	c.printf("%s\n", s)
+	c.written = true
+}
+
+func (c *converter) page() {
+	c.printf("[p]\n")
+}
+
+func (c *converter) printf(format string, a ...any) {
+	if c.err != nil {
+		return
+	}
+	_, c.err = fmt.Fprintf(c.w, format, a...)
+}
+
+// ルビを変換する
+// ｜漢字《かんじ》のように開始位置が指定されていればそこから、なければ直前の漢字の並びにルビをふる
+// ルビをふる文字がないときは、本文を欠かさないように読みをそのまま残す
+func convertRuby(line string) string {
+	var out []rune
+	runes := []rune(line)
+	base := -1 // ｜で指定された開始位置
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '｜':
+			base = len(out)
+			continue
+		case '《':
+			end := indexRune(runes[i+1:], '》')
+			if end < 0 {
+				break
+			}
+			ruby := string(runes[i+1 : i+1+end])
+			start := base
+			if start < 0 {
+				start = len(out)
+				for start > 0 && isKanji(out[start-1]) {
+					start--
+				}
+			}
+			if start == len(out) {
+				// ルビをふる文字がないので、読みを本文として残す
+				out = append(out, []rune(ruby)...)
+				i += end + 1
+				base = -1
+				continue
+			}
+			text := string(out[start:])
+			out = append(out[:start], []rune(fmt.Sprintf(`[ruby text=%s]%s[endruby]`, ast.Quote(ruby), text))...)
+			i += end + 1
+			base = -1
+			continue
+		}
+		out = append(out, r)
+	}
+
+	return string(out)
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, v := range runes {
+		if v == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ルビの対象となる漢字か判定する
+func isKanji(r rune) bool {
+	return unicode.Is(unicode.Han, r) || strings.ContainsRune("々〆ヶ〇仝", r)
+}
@@ -0,0 +1,108 @@
+package aozora
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "ゴールデンファイルを更新する")
+
+func TestConvert_ゴールデンファイルと一致する(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			assert.NoError(t, err)
+			defer f.Close()
+
+			var b strings.Builder
+			assert.NoError(t, Convert(&b, f))
+
+			golden := strings.TrimSuffix(path, ".txt") + ".sce"
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, []byte(b.String()), 0644))
+			}
+			expect, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(expect), b.String())
+		})
+	}
+}
+
+func TestConvertProgram_ラベルに変換する(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "botchan.txt"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	program, err := ConvertProgram(f)
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, stmt := range program.Statements {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		assert.True(t, ok)
+		if label, ok := es.Expression.(*ast.LabelLiteral); ok {
+			names = append(names, label.LabelName.Value)
+		}
+	}
+	assert.Equal(t, []string{"start", "ch1", "ch2", "ch3"}, names)
+}
+
+func TestConvertRuby(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{
+			name:   "直前の漢字にルビをふる",
+			input:  "無鉄砲《むてっぽう》で",
+			expect: `[ruby text="むてっぽう"]無鉄砲[endruby]で`,
+		},
+		{
+			name:   "｜で開始位置を指定できる",
+			input:  "夕方｜折戸《おりど》の",
+			expect: `夕方[ruby text="おりど"]折戸[endruby]の`,
+		},
+		{
+			name:   "漢字以外も｜で指定すればルビをふれる",
+			input:  "｜ハムレット《王子》",
+			expect: `[ruby text="王子"]ハムレット[endruby]`,
+		},
+		{
+			name:   "踊り字も漢字として扱う",
+			input:  "時々《ときどき》",
+			expect: `[ruby text="ときどき"]時々[endruby]`,
+		},
+		{
+			name:   "ルビをふる文字がなければ読みを本文として残す",
+			input:  "おれは《これ》を",
+			expect: "おれはこれを",
+		},
+		{
+			name:   "ルビの引用符はエスケープする",
+			input:  `｜ABC《"エー"》`,
+			expect: `[ruby text="\"エー\""]ABC[endruby]`,
+		},
+		{
+			name:   "閉じていない《はそのまま残す",
+			input:  "漢字《かんじ",
+			expect: "漢字《かんじ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, convertRuby(tt.input))
+		})
+	}
+}
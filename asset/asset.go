@@ -0,0 +1,122 @@
+// シナリオから参照している素材を集めるパッケージ
+// 読み込み時に素材の有無を確かめたり、ラベルを再生する前に素材を読み込んでおいたりするのに使う
+package asset
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/token"
+)
+
+// 素材の種類
+type Kind string
+
+const (
+	KindImage Kind = "image"
+)
+
+// 素材の参照
+type Ref struct {
+	Kind Kind
+	// 素材のパス。fs.FSのパスとして扱う
+	Path string
+	// 参照しているラベル
+	Label string
+	// 参照しているイベントのソース上の位置
+	Pos token.Position
+}
+
+// シナリオが参照しているすべての素材
+type Manifest struct {
+	// 出現順の参照。同じ素材を複数回参照していれば、そのぶん含む
+	Refs []Ref
+}
+
+// 評価器に登録されているすべてのラベルから、素材の参照を集める
+func Collect(e *event.Evaluator) (*Manifest, error) {
+	labels, err := e.CompileAll()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Refs: []Ref{}}
+	for _, label := range labels {
+		for i, eve := range label.Events {
+			switch eve := eve.(type) {
+			case *event.ChangeBg:
+				m.Refs = append(m.Refs, Ref{Kind: KindImage, Path: eve.Source, Label: label.Name, Pos: label.Positions[i]})
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// 重複を除いた素材のパスを、出現順に返す
+func (m *Manifest) Paths() []string {
+	return paths(m.Refs, func(Ref) bool { return true })
+}
+
+// ラベルを再生する前に読み込んでおくとよい素材のパスを返す
+// ラベル自身と、そのラベルからジャンプする先や選択肢で移動する先のラベルで使う素材を含む
+func (m *Manifest) Preload(e *event.Evaluator, label string) ([]string, error) {
+	c, err := e.Compile(label)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]bool{label: true}
+	for _, eve := range c.Events {
+		switch eve := eve.(type) {
+		case *event.Jump:
+			labels[eve.Target] = true
+		case *event.Choice:
+			labels[eve.Target] = true
+		}
+	}
+
+	return paths(m.Refs, func(r Ref) bool { return labels[r.Label] }), nil
+}
+
+func paths(refs []Ref, filter func(Ref) bool) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, r := range refs {
+		if seen[r.Path] || !filter(r) {
+			continue
+		}
+		seen[r.Path] = true
+		result = append(result, r.Path)
+	}
+
+	return result
+}
+
+// 素材が見つからない
+type MissingError struct {
+	Ref Ref
+	Err error
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("%s: 素材が見つからない: %s (ラベル %s)", e.Ref.Pos, e.Ref.Path, e.Ref.Label)
+}
+
+func (e *MissingError) Unwrap() error {
+	return e.Err
+}
+
+// すべての参照について、素材が存在するか確かめる
+// 見つからない参照ごとに*MissingErrorを返す。すべて存在すればnilを返す
+func (m *Manifest) Verify(fsys fs.FS) error {
+	errs := []error{}
+	for _, r := range m.Refs {
+		if _, err := fs.Stat(fsys, r.Path); err != nil {
+			errs = append(errs, &MissingError{Ref: r, Err: err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,84 @@
+package asset
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/token"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `*start
+[image source="file/black.png"]
+はじまり[p]
+[jump target=ch1]
+*ch1
+[image source="file/sky.jpg"]
+[image source="file/black.png"]
+[jump target=ch2]
+*ch2
+[image source="file/typo.png"]
+[choice text="森へ" target=forest][select]
+*forest
+[image source="file/forest.jpg"]`
+
+func prepare(t *testing.T) (*event.Evaluator, *Manifest) {
+	t.Helper()
+
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	m, err := Collect(e)
+	assert.NoError(t, err)
+
+	return e, m
+}
+
+func TestCollect(t *testing.T) {
+	_, m := prepare(t)
+
+	assert.Equal(t, 5, len(m.Refs))
+	assert.Equal(t, Ref{Kind: KindImage, Path: "file/sky.jpg", Label: "ch1", Pos: token.Position{Offset: 78, Line: 6, Column: 1}}, m.Refs[1])
+	assert.Equal(t, []string{"file/black.png", "file/sky.jpg", "file/typo.png", "file/forest.jpg"}, m.Paths())
+}
+
+func TestPreload(t *testing.T) {
+	e, m := prepare(t)
+
+	paths, err := m.Preload(e, "start")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"file/black.png", "file/sky.jpg"}, paths)
+
+	// 選択肢で移動する先も含む
+	paths, err = m.Preload(e, "ch2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"file/typo.png", "file/forest.jpg"}, paths)
+
+	_, err = m.Preload(e, "not exists")
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	_, m := prepare(t)
+	fsys := fstest.MapFS{
+		"file/black.png":  {},
+		"file/sky.jpg":    {},
+		"file/forest.jpg": {},
+	}
+
+	err := m.Verify(fsys)
+	assert.EqualError(t, err, "10:1: 素材が見つからない: file/typo.png (ラベル ch2)")
+	var missing *MissingError
+	assert.True(t, errors.As(err, &missing))
+	assert.Equal(t, "file/typo.png", missing.Ref.Path)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	fsys["file/typo.png"] = &fstest.MapFile{}
+	assert.NoError(t, m.Verify(fsys))
+}
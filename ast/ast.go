@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"sort"
+	"strings"
 
 	"github.com/kijimaD/nova/token"
 )
@@ -25,6 +26,8 @@ type Expression interface {
 // 構文解析器が生成する全てのASTのルートノードになる
 type Program struct {
 	Statements []Statement
+	// 末尾の文より後ろにあるコメント
+	Comments []*Comment
 }
 
 // インターフェースで定義されている関数の1つ
@@ -52,6 +55,7 @@ func (p *Program) String() string {
 type ExpressionStatement struct {
 	Token      token.Token // 式の最初のトークン
 	Expression Expression  // 式を保持
+	Comments   []*Comment  // 文の直前にあるコメント
 }
 
 func (es *ExpressionStatement) statementNode()       {}
@@ -121,7 +125,7 @@ func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string       { return i.Value }
 
 type NamedParams struct {
-	Map map[string]string
+	Map map[string]Expression
 }
 
 func (n *NamedParams) expressionNode() {}
@@ -133,16 +137,88 @@ func (n *NamedParams) String() string {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-	for i, k := range keys {
-		v := n.Map[k]
+	for _, k := range keys {
 		out.WriteString(" ")
 		out.WriteString(k)
 		out.WriteString("=")
-		out.WriteString(v)
-		if i != len(keys)-1 {
-			out.WriteString(",")
+		out.WriteString(n.Map[k].String())
+	}
+
+	return out.String()
+}
+
+// パラメータの値を、型に関係なく書かれたとおりの文字列で返す
+func (n *NamedParams) Lookup(key string) (string, bool) {
+	v, ok := n.Map[key]
+	if !ok {
+		return "", false
+	}
+	switch v := v.(type) {
+	case *StringLiteral:
+		return v.Value, true
+	case *Identifier:
+		return v.Value, true
+	}
+
+	return v.TokenLiteral(), true
+}
+
+// パラメータの値を文字列で返す。存在しなければ空文字を返す
+func (n *NamedParams) Get(key string) string {
+	v, _ := n.Lookup(key)
+
+	return v
+}
+
+// 文字列リテラル。"value"もしくは'value'
+type StringLiteral struct {
+	Token token.Token // token.STRINGトークン
+	Value string      // エスケープを解釈した値
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return Quote(sl.Value) }
+
+// 整数リテラル
+type IntegerLiteral struct {
+	Token token.Token // token.INTトークン
+	Value int64
+}
+
+func (il *IntegerLiteral) expressionNode()      {}
+func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+
+// 小数リテラル
+type FloatLiteral struct {
+	Token token.Token // token.FLOATトークン
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+// 文字列をダブルクォートで囲み、必要な文字をエスケープする
+func Quote(s string) string {
+	var out strings.Builder
+
+	out.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			out.WriteRune('\\')
+			out.WriteRune(r)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteRune(r)
 		}
 	}
+	out.WriteString(`"`)
 
 	return out.String()
 }
@@ -179,9 +255,18 @@ func (le *LabelLiteral) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(token.ASTERISK)
-	out.WriteString(le.TokenLiteral())
+	out.WriteString(le.LabelName.Value)
 	out.WriteString("\n")
 	out.WriteString(le.Body.String())
 
 	return out.String()
 }
+
+// コメント。実行には影響せず、整形や変換のときに保持するためだけに持つ
+type Comment struct {
+	Token token.Token // token.COMMENTトークン
+	Text  string      // 記号を除いたコメントの内容
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) String() string       { return c.Token.Literal }
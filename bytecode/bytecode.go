@@ -0,0 +1,407 @@
+// コンパイル済みシナリオのバイナリ形式を扱うパッケージ
+// 起動時に構文解析しなくて済むように、ラベルごとのイベント列とソース上の位置をそのまま保存する
+//
+//	ヘッダ   "NOVA" バージョン
+//	ラベル数 ラベル...
+//	ラベル   名前 イベント数 (命令 オペランド... 行 列 オフセット)...
+//
+// 数値は可変長整数、文字列は長さとUTF-8のバイト列、小数はIEEE 754のリトルエンディアンで書き込む
+package bytecode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/token"
+	"github.com/kijimaD/nova/utils"
+)
+
+const (
+	// ファイル先頭の識別子
+	Magic = "NOVA"
+	// 形式のバージョン。互換性のない変更をしたら上げる
+	// 2: 選択肢の命令を追加
+	Version = 2
+)
+
+var (
+	// 先頭の識別子が一致しない
+	ErrInvalidFormat = errors.New("bytecodeの形式ではない")
+	// バージョンが一致しない。シナリオをコンパイルし直す必要がある
+	ErrIncompatibleVersion = errors.New("bytecodeのバージョンに対応していない")
+)
+
+// 命令。イベントの種類に対応する
+const (
+	opMsgEmit byte = iota + 1
+	opFlush
+	opLineEndWait
+	opChangeBg
+	opWait
+	opDelay
+	opFont
+	opResetFont
+	opRuby
+	opEndRuby
+	opJump
+	opNewline
+	opChoice
+	opSelect
+)
+
+// Fontで指定されている項目のフラグ
+const (
+	fontColor byte = 1 << iota
+	fontSize
+	fontBold
+	fontItalic
+	fontEmphasis
+)
+
+// 文字列の長さの上限。壊れたファイルで巨大な領域を確保しないようにする
+const maxStringLen = 1 << 24
+
+// シナリオを読み込んで、すべてのラベルをコンパイルして書き込む
+func Compile(w io.Writer, r io.Reader) error {
+	p := parser.NewParser(lexer.NewLexerFromReader(r))
+	e := event.NewEvaluator()
+	for {
+		stmt, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		e.Eval(stmt)
+	}
+	labels, err := e.CompileAll()
+	if err != nil {
+		return err
+	}
+	if errs := e.Errors(); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return Encode(w, labels)
+}
+
+// コンパイル済みのラベルを書き込む
+func Encode(w io.Writer, labels []*event.CompiledLabel) error {
+	enc := encoder{w: bufio.NewWriter(w)}
+	enc.bytes([]byte(Magic))
+	enc.uvarint(Version)
+	enc.uvarint(uint64(len(labels)))
+	for _, label := range labels {
+		enc.string(label.Name)
+		enc.uvarint(uint64(len(label.Events)))
+		for i, e := range label.Events {
+			if err := enc.event(e); err != nil {
+				return err
+			}
+			pos := label.Positions[i]
+			enc.uvarint(uint64(pos.Line))
+			enc.uvarint(uint64(pos.Column))
+			enc.uvarint(uint64(pos.Offset))
+		}
+	}
+	if enc.err != nil {
+		return enc.err
+	}
+
+	return enc.w.Flush()
+}
+
+// 書き込まれたラベルを読み込む
+func Decode(r io.Reader) ([]*event.CompiledLabel, error) {
+	return decode(r, Version)
+}
+
+// バージョンがversionのファイルだけを読み込む
+func decode(r io.Reader, version uint64) ([]*event.CompiledLabel, error) {
+	dec := decoder{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(dec.r, magic); err != nil || string(magic) != Magic {
+		return nil, ErrInvalidFormat
+	}
+	if v := dec.uvarint(); dec.err == nil && v != version {
+		return nil, fmt.Errorf("%w: ファイルのバージョン %d, 対応するバージョン %d", ErrIncompatibleVersion, v, version)
+	}
+
+	labels := []*event.CompiledLabel{}
+	n := dec.uvarint()
+	for i := uint64(0); i < n && dec.err == nil; i++ {
+		label := &event.CompiledLabel{Name: dec.string(), Events: []event.Event{}, Positions: []token.Position{}}
+		m := dec.uvarint()
+		for j := uint64(0); j < m && dec.err == nil; j++ {
+			e := dec.event()
+			pos := token.Position{
+				Line:   int(dec.uvarint()),
+				Column: int(dec.uvarint()),
+				Offset: int(dec.uvarint()),
+			}
+			label.Events = append(label.Events, e)
+			label.Positions = append(label.Positions, pos)
+		}
+		labels = append(labels, label)
+	}
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	return labels, nil
+}
+
+// 最初に発生したエラーを保持して、以降の書き込みをしない
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (enc *encoder) bytes(b []byte) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.Write(b)
+}
+
+func (enc *encoder) uvarint(v uint64) {
+	enc.bytes(binary.AppendUvarint(nil, v))
+}
+
+func (enc *encoder) varint(v int64) {
+	enc.bytes(binary.AppendVarint(nil, v))
+}
+
+func (enc *encoder) string(s string) {
+	enc.uvarint(uint64(len(s)))
+	enc.bytes([]byte(s))
+}
+
+func (enc *encoder) bool(b bool) {
+	if b {
+		enc.bytes([]byte{1})
+		return
+	}
+	enc.bytes([]byte{0})
+}
+
+func (enc *encoder) float(f float64) {
+	enc.bytes(binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (enc *encoder) event(e event.Event) error {
+	switch e := e.(type) {
+	case *event.MsgEmit:
+		enc.bytes([]byte{opMsgEmit})
+		enc.string(e.Body)
+	case *event.Flush:
+		enc.bytes([]byte{opFlush})
+	case *event.LineEndWait:
+		enc.bytes([]byte{opLineEndWait})
+	case *event.ChangeBg:
+		enc.bytes([]byte{opChangeBg})
+		enc.string(e.Source)
+	case *event.Wait:
+		enc.bytes([]byte{opWait})
+		enc.varint(int64(e.DurationMsec))
+	case *event.Delay:
+		enc.bytes([]byte{opDelay})
+		enc.varint(int64(e.Speed))
+		enc.bool(e.NoWait)
+	case *event.Font:
+		var flags byte
+		for flag, set := range map[byte]bool{
+			fontColor:    e.Color != nil,
+			fontSize:     e.Size != nil,
+			fontBold:     e.Bold != nil,
+			fontItalic:   e.Italic != nil,
+			fontEmphasis: e.Emphasis != nil,
+		} {
+			if set {
+				flags |= flag
+			}
+		}
+		enc.bytes([]byte{opFont, flags})
+		if e.Color != nil {
+			enc.string(*e.Color)
+		}
+		if e.Size != nil {
+			enc.float(*e.Size)
+		}
+		for _, b := range []*bool{e.Bold, e.Italic, e.Emphasis} {
+			if b != nil {
+				enc.bool(*b)
+			}
+		}
+	case *event.ResetFont:
+		enc.bytes([]byte{opResetFont})
+	case *event.Ruby:
+		enc.bytes([]byte{opRuby})
+		enc.string(e.Text)
+	case *event.EndRuby:
+		enc.bytes([]byte{opEndRuby})
+	case *event.Jump:
+		enc.bytes([]byte{opJump})
+		enc.string(e.Target)
+	case *event.Newline:
+		enc.bytes([]byte{opNewline})
+	case *event.Choice:
+		enc.bytes([]byte{opChoice})
+		enc.string(e.Text)
+		enc.string(e.Target)
+	case *event.Select:
+		enc.bytes([]byte{opSelect})
+	default:
+		return fmt.Errorf("bytecodeに変換できないイベント: %s", e)
+	}
+
+	return nil
+}
+
+// 最初に発生したエラーを保持して、以降はゼロ値を返す
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (dec *decoder) fail(err error) {
+	if dec.err != nil {
+		return
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	dec.err = err
+}
+
+func (dec *decoder) byte() byte {
+	if dec.err != nil {
+		return 0
+	}
+	b, err := dec.r.ReadByte()
+	if err != nil {
+		dec.fail(err)
+	}
+	return b
+}
+
+func (dec *decoder) uvarint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		dec.fail(err)
+	}
+	return v
+}
+
+func (dec *decoder) varint() int64 {
+	if dec.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(dec.r)
+	if err != nil {
+		dec.fail(err)
+	}
+	return v
+}
+
+func (dec *decoder) string() string {
+	n := dec.uvarint()
+	if dec.err != nil {
+		return ""
+	}
+	if n > maxStringLen {
+		dec.fail(fmt.Errorf("文字列が長すぎる: %d", n))
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(dec.r, b); err != nil {
+		dec.fail(err)
+		return ""
+	}
+	return string(b)
+}
+
+func (dec *decoder) bool() bool {
+	return dec.byte() != 0
+}
+
+func (dec *decoder) float() float64 {
+	var b [8]byte
+	for i := range b {
+		b[i] = dec.byte()
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (dec *decoder) event() event.Event {
+	op := dec.byte()
+	if dec.err != nil {
+		return nil
+	}
+	switch op {
+	case opMsgEmit:
+		return &event.MsgEmit{Body: dec.string()}
+	case opFlush:
+		return &event.Flush{}
+	case opLineEndWait:
+		return &event.LineEndWait{}
+	case opChangeBg:
+		return &event.ChangeBg{Source: dec.string()}
+	case opWait:
+		return &event.Wait{DurationMsec: time.Duration(dec.varint())}
+	case opDelay:
+		return &event.Delay{Speed: time.Duration(dec.varint()), NoWait: dec.bool()}
+	case opFont:
+		flags := dec.byte()
+		font := &event.Font{}
+		if flags&fontColor != 0 {
+			font.Color = utils.GetPtr(dec.string())
+		}
+		if flags&fontSize != 0 {
+			font.Size = utils.GetPtr(dec.float())
+		}
+		for _, f := range []struct {
+			flag byte
+			dst  **bool
+		}{
+			{fontBold, &font.Bold},
+			{fontItalic, &font.Italic},
+			{fontEmphasis, &font.Emphasis},
+		} {
+			if flags&f.flag != 0 {
+				*f.dst = utils.GetPtr(dec.bool())
+			}
+		}
+		return font
+	case opResetFont:
+		return &event.ResetFont{}
+	case opRuby:
+		return &event.Ruby{Text: dec.string()}
+	case opEndRuby:
+		return &event.EndRuby{}
+	case opJump:
+		return &event.Jump{Target: dec.string()}
+	case opNewline:
+		return &event.Newline{}
+	case opChoice:
+		return &event.Choice{Text: dec.string(), Target: dec.string()}
+	case opSelect:
+		return &event.Select{}
+	}
+	dec.fail(fmt.Errorf("不明な命令: %d", op))
+
+	return nil
+}
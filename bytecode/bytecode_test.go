@@ -0,0 +1,95 @@
+package bytecode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `*start
+こんにちは[l]世界[p]
+[image source="test.png"]
+[wait time=100]
+[delay speed=30][delay speed=nowait]
+[font color="#ff0000" size=1.5 bold=true italic=false][resetfont]
+[ruby text="かんじ"]漢字[endruby][r]
+[choice text="進む" target=第一章][select]
+[jump target=第一章]
+*第一章
+おわり[p]`
+
+func compile(t *testing.T, input string) []*event.CompiledLabel {
+	t.Helper()
+
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	labels, err := e.CompileAll()
+	assert.NoError(t, err)
+
+	return labels
+}
+
+func TestEncode_読み込むと元に戻る(t *testing.T) {
+	labels := compile(t, input)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, labels))
+	assert.True(t, strings.HasPrefix(buf.String(), Magic))
+
+	result, err := Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, labels, result)
+}
+
+func TestCompile_シナリオから直接変換できる(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Compile(&buf, strings.NewReader(input)))
+
+	result, err := Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, compile(t, input), result)
+}
+
+func TestCompile_評価エラーを返す(t *testing.T) {
+	var buf bytes.Buffer
+	err := Compile(&buf, strings.NewReader(`*start
+[wait time=xxx]`))
+	assert.Error(t, err)
+}
+
+func TestDecode_形式が異なるとエラーを返す(t *testing.T) {
+	{
+		_, err := Decode(strings.NewReader("*start\n"))
+		assert.ErrorIs(t, err, ErrInvalidFormat)
+	}
+	{
+		// バージョンが異なる
+		_, err := Decode(strings.NewReader(Magic + "\x63\x00"))
+		assert.ErrorIs(t, err, ErrIncompatibleVersion)
+		assert.ErrorContains(t, err, "ファイルのバージョン 99")
+	}
+	{
+		// 途中で終わっている
+		var buf bytes.Buffer
+		assert.NoError(t, Encode(&buf, compile(t, input)))
+		_, err := Decode(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+		assert.Error(t, err)
+	}
+}
+
+func TestDecode_古い形式の読み込み側はバージョンで拒否する(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, compile(t, input)))
+
+	// 選択肢を知らないバージョン1の読み込み側は、不明な命令ではなくバージョンの違いとして報告する
+	_, err := decode(&buf, 1)
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	assert.ErrorContains(t, err, "ファイルのバージョン 2, 対応するバージョン 1")
+}
@@ -0,0 +1,55 @@
+// 青空文庫形式のテキストをシナリオファイルに変換するコマンド
+//
+//	aozora2sce [-encoding sjis|utf8] [-o output.sce] [input.txt]
+//
+// 入力ファイルを省略すると標準入力から読み込む
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kijimaD/nova/aozora"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+func main() {
+	encoding := flag.String("encoding", "sjis", "入力ファイルの文字コード(sjis|utf8)")
+	output := flag.String("o", "", "出力先のファイル。省略すると標準出力に書き出す")
+	flag.Parse()
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	switch *encoding {
+	case "sjis":
+		r = transform.NewReader(r, japanese.ShiftJIS.NewDecoder())
+	case "utf8":
+	default:
+		log.Fatal(fmt.Errorf("未対応の文字コード: %s", *encoding))
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := aozora.Convert(w, r); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+// シナリオファイルをコンパイル済みの形式に変換するコマンド
+//
+//	novac [-o output] input.sce
+//
+// 出力先を省略すると、入力ファイルの拡張子を.novcに変えたファイルに書き出す
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kijimaD/nova/bytecode"
+)
+
+var output = flag.String("o", "", "出力先のファイル")
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: novac [-o output] input.sce")
+		os.Exit(2)
+	}
+	input := flag.Arg(0)
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(input, filepath.Ext(input)) + ".novc"
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if err := bytecode.Compile(&buf, f); err != nil {
+		log.Fatalf("%s: %s", input, err)
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
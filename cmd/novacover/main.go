@@ -0,0 +1,93 @@
+// シナリオのカバレッジを表示するコマンド
+//
+//	novacover -profile cover.out[,cover2.out...] [-html] [-o output] input.sce
+//
+// 実行した行と実行しなかった行を、注釈つきのテキストか色分けしたHTMLで出力する
+// 複数の記録を指定すると、実行回数を足し合わせる。記録のうちinput.sceのイベントだけを使う
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/kijimaD/nova/cover"
+)
+
+var (
+	profiles = flag.String("profile", "", "カバレッジの記録。カンマ区切りで複数指定できる")
+	asHTML   = flag.Bool("html", false, "HTMLで出力する")
+	output   = flag.String("o", "", "出力先のファイル。指定しないときは標準出力に書き込む")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 || *profiles == "" {
+		fmt.Fprintln(os.Stderr, "usage: novacover -profile cover.out[,cover2.out...] [-html] [-o output] input.sce")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	p := &cover.Profile{}
+	for _, name := range strings.Split(*profiles, ",") {
+		other, err := readProfile(name)
+		if err != nil {
+			log.Fatalf("%s: %s", name, err)
+		}
+		p.Merge(other)
+	}
+	p = p.File(path)
+	if len(p.Blocks) == 0 {
+		log.Fatalf("%s: 記録にこのファイルのイベントがない", path)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := p.ResolveLabels(string(src)); err != nil {
+		log.Fatalf("%s: %s", path, err)
+	}
+	lines, err := cover.Annotate(string(src), p)
+	if err != nil {
+		log.Fatalf("%s: %s", path, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	summary := p.Summary()
+	if *asHTML {
+		err = cover.WriteHTML(w, path, summary, lines)
+	} else {
+		fmt.Fprintf(w, "%s: %s\n", path, summary)
+		if labels := p.UncoveredLabels(); len(labels) > 0 {
+			fmt.Fprintf(w, "通らなかったラベル: %s\n", strings.Join(labels, ", "))
+		}
+		fmt.Fprintln(w)
+		err = cover.WriteText(w, lines)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readProfile(path string) (*cover.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return cover.ParseProfile(f)
+}
@@ -0,0 +1,149 @@
+// 実行中のゲームのデバッグサーバーを操作するコマンド
+//
+//	novadebug [-addr localhost:6060] [-json] [state|pause|continue|step|click|jump LABEL|break [LABEL|LINE|[COMMAND]...]|clear]
+//
+// ゲーム側では、debugserver.NewServer(q)を作ってListenAndServeしておく
+// 操作のあとは、その時点の状態を表示する。breakに引数を渡すと、ブレークポイントを置き換える。数字は行番号、[jump]のように[]で囲んだものはコマンド名、それ以外はラベル名とみなす
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kijimaD/nova/debugserver"
+)
+
+var (
+	addr   = flag.String("addr", "localhost:6060", "デバッグサーバーのアドレス")
+	asJSON = flag.Bool("json", false, "JSONで出力する")
+)
+
+const usage = "usage: novadebug [-addr localhost:6060] [-json] [state|pause|continue|step|click|jump LABEL|break [LABEL|LINE|[COMMAND]...]|clear]"
+
+func main() {
+	flag.Parse()
+
+	c := debugserver.NewClient(*addr)
+	cmd := "state"
+	if flag.NArg() > 0 {
+		cmd = flag.Arg(0)
+	}
+	args := flag.Args()
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	var st *debugserver.State
+	var err error
+	switch cmd {
+	case "state":
+		st, err = c.State()
+	case "pause":
+		st, err = c.Pause()
+	case "continue":
+		st, err = c.Continue()
+	case "step":
+		st, err = c.Step()
+	case "click":
+		st, err = c.Click()
+	case "jump":
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		st, err = c.Jump(args[0])
+	case "break", "clear":
+		if len(args) > 0 || cmd == "clear" {
+			if err := c.SetBreakpoints(parseBreakpoints(args)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		breakpoints, err := c.Breakpoints()
+		if err != nil {
+			log.Fatal(err)
+		}
+		printBreakpoints(breakpoints)
+		return
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(st); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printState(st)
+}
+
+func parseBreakpoints(args []string) []debugserver.Breakpoint {
+	result := []debugserver.Breakpoint{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "[") && strings.HasSuffix(arg, "]") {
+			result = append(result, debugserver.Breakpoint{Command: strings.Trim(arg, "[]")})
+			continue
+		}
+		if line, err := strconv.Atoi(arg); err == nil {
+			result = append(result, debugserver.Breakpoint{Line: line})
+			continue
+		}
+		result = append(result, debugserver.Breakpoint{Label: arg})
+	}
+
+	return result
+}
+
+func printBreakpoints(breakpoints []debugserver.Breakpoint) {
+	if *asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(breakpoints); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, b := range breakpoints {
+		switch {
+		case b.Label != "":
+			fmt.Printf("*%s\n", b.Label)
+		case b.Command != "":
+			fmt.Printf("[%s]\n", b.Command)
+		default:
+			fmt.Printf("%d行目\n", b.Line)
+		}
+	}
+}
+
+func printState(st *debugserver.State) {
+	status := ""
+	switch {
+	case st.Paused:
+		status = fmt.Sprintf(" [一時停止: %s]", st.Reason)
+	case st.Ended:
+		status = " [終了]"
+	}
+	fmt.Printf("%s:%d (%d行目) %s%s\n", st.Label, st.Index, st.Line, st.Event, status)
+	fmt.Printf("表示: %s\n", strings.ReplaceAll(st.Display, "\n", "⏎"))
+	fmt.Printf("待ち: %s\n", strings.Join(st.Waiting, " "))
+	if len(st.Choices) > 0 {
+		fmt.Println("選択肢:")
+		for i, c := range st.Choices {
+			fmt.Printf("  %d: %s\n", i, c)
+		}
+	}
+	fmt.Printf("履歴: %s\n", strings.Join(st.History, " > "))
+	fmt.Println("直近のイベント:")
+	for _, r := range st.Recent {
+		fmt.Printf("  %s:%d (%d行目) %s\n", r.Label, r.Index, r.Line, r.Event)
+	}
+}
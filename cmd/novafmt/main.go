@@ -0,0 +1,96 @@
+// シナリオファイルの書式を整えるコマンド
+//
+//	novafmt [-l] [-w] [path ...]
+//
+// パスを省略すると標準入力を整形して標準出力に書き出す
+// ディレクトリを指定すると、配下の.sceファイルを対象にする
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/kijimaD/nova/format"
+)
+
+var (
+	list  = flag.Bool("l", false, "書式が異なるファイル名を表示する")
+	write = flag.Bool("w", false, "結果をファイルに上書きする")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		res, err := format.Source(src)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := os.Stdout.Write(res); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	failed := false
+	for _, root := range flag.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (path != root && filepath.Ext(path) != ".sce") {
+				return nil
+			}
+			if err := processFile(path); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func processFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	res, err := format.Source(src)
+	if err != nil {
+		return err
+	}
+	changed := !bytes.Equal(src, res)
+
+	if *list && changed {
+		fmt.Println(path)
+	}
+	if *write && changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, res, info.Mode().Perm())
+	}
+	if !*list && !*write {
+		_, err = os.Stdout.Write(res)
+	}
+
+	return err
+}
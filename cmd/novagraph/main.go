@@ -0,0 +1,69 @@
+// ラベル間の遷移をグラフにするコマンド
+//
+//	novagraph [-format dot|mermaid] [-check] input.sce
+//
+// グラフを標準出力に書き出す。-checkを指定するとグラフの代わりに問題点を表示し、問題があれば終了コード1で終了する
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/graph"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+)
+
+var (
+	format = flag.String("format", "dot", "出力形式(dot|mermaid)")
+	check  = flag.Bool("check", false, "行き止まり、抜け出せないループ、到達できないラベル、存在しない遷移先を表示する")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: novagraph [-format dot|mermaid] [-check] input.sce")
+		os.Exit(2)
+	}
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	program, err := parser.NewParser(lexer.NewLexerFromReader(f)).ParseProgram()
+	if err != nil {
+		log.Fatal(err)
+	}
+	e := event.NewEvaluator()
+	e.Eval(program)
+	g, err := graph.Build(e)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *check {
+		r := g.Analyze()
+		fmt.Print(r)
+		if r.HasProblems() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch *format {
+	case "dot":
+		err = g.WriteDOT(os.Stdout)
+	case "mermaid":
+		err = g.WriteMermaid(os.Stdout)
+	default:
+		err = fmt.Errorf("未対応の出力形式: %s", *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
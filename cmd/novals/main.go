@@ -0,0 +1,24 @@
+// シナリオファイルのLanguage Serverを起動するコマンド
+//
+//	novals
+//
+// 標準入出力でエディタとやりとりする。ログは標準エラー出力に書き込む
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kijimaD/nova/lsp"
+)
+
+func main() {
+	flag.Parse()
+
+	s := lsp.NewServer()
+	s.Logger = log.New(os.Stderr, lsp.Name+": ", log.LstdFlags)
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
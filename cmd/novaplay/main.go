@@ -0,0 +1,58 @@
+// シナリオを端末で遊ぶコマンド
+//
+//	novaplay [-width 80] [-auto 2s] input.sce
+//
+// 本文を端末の幅で折り返して表示し、背景の変更は状態行で知らせる
+// Enterで進み、sで飛ばし、aで自動送りを切り替え、bでバックログを表示し、数字で選択肢を選ぶ
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/kijimaD/nova/loader"
+	"github.com/kijimaD/nova/terminal"
+)
+
+var (
+	width = flag.Int("width", defaultWidth(), "折り返す幅。半角1文字を1として数える")
+	auto  = flag.Duration("auto", terminal.DefaultAutoDelay, "自動送りで、クリック待ちになってから進めるまでの時間")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: novaplay [-width 80] [-auto 2s] input.sce")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	q, err := loader.NewQueueFromReader(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := terminal.NewPlayer(q, os.Stdin, os.Stdout)
+	p.Width = *width
+	p.AutoDelay = *auto
+	if err := p.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 環境変数COLUMNSがあれば、端末の幅として使う
+func defaultWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+
+	return terminal.DefaultWidth
+}
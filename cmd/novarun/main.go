@@ -0,0 +1,135 @@
+// シナリオを画面なしで最後まで実行するコマンド
+//
+//	novarun [-choices 0,1] [-all] [-events] [-json] [-timeout 5s] [-coverprofile cover.out] input.sce
+//
+// 表示した本文、通知、再生したラベル、選んだ選択肢を出力する
+// 無限ループや進行が止まったルートがあれば、終了コード1で終わる
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kijimaD/nova/cover"
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/headless"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+)
+
+var (
+	choices = flag.String("choices", "", "選ぶ選択肢の番号をカンマ区切りで指定する。使い切ったあとは最初の選択肢を選ぶ")
+	all     = flag.Bool("all", false, "すべてのルートを実行する")
+	asJSON  = flag.Bool("json", false, "JSONで出力する")
+	events  = flag.Bool("events", false, "実行したすべてのイベントを出力する")
+	timeout = flag.Duration("timeout", headless.DefaultTimeout, "クリック待ちになるまで待つ時間の上限")
+	profile = flag.String("coverprofile", "", "実行したラベルとイベントの記録を書き込むファイル")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: novarun [-choices 0,1] [-all] [-events] [-json] [-timeout 5s] [-coverprofile cover.out] input.sce")
+		os.Exit(2)
+	}
+
+	e, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := headless.NewRunner(e)
+	r.Timeout = *timeout
+	r.RecordEvents = *events
+	if *profile != "" {
+		r.Coverage = event.NewCoverage()
+	}
+
+	var transcripts []*headless.Transcript
+	var runErr error
+	if *all {
+		transcripts, runErr = r.Explore()
+	} else {
+		script, err := parseChoices(*choices)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t, err := r.Run(script)
+		transcripts, runErr = []*headless.Transcript{t}, err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(transcripts); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fmt.Print(headless.FormatRoutes(transcripts))
+	}
+
+	if *profile != "" {
+		if err := writeProfile(*profile, flag.Arg(0), e, r.Coverage); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if runErr != nil {
+		fmt.Fprintln(os.Stderr, runErr)
+		os.Exit(1)
+	}
+}
+
+func load(path string) (*event.Evaluator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	program, err := parser.NewParser(lexer.NewLexerFromReader(f)).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	e := event.NewEvaluator()
+	e.Eval(program)
+
+	return e, nil
+}
+
+func writeProfile(path string, src string, e *event.Evaluator, c *event.Coverage) error {
+	p, err := cover.NewProfile(src, e, c)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func parseChoices(s string) ([]int, error) {
+	result := []int{}
+	if s == "" {
+		return result, nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("選択肢の番号が不正: %q", v)
+		}
+		result = append(result, i)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,81 @@
+// シナリオの統計を表示するコマンド
+//
+//	novastat [-json] [-cpm 500] input.sce ...
+//
+// ファイルごとに、ラベル別の文字数、ページ数、画像数、イベント数、読了時間の目安を表示する
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/stat"
+)
+
+var (
+	asJSON = flag.Bool("json", false, "JSONで出力する")
+	cpm    = flag.Float64("cpm", stat.DefaultCharsPerMinute, "読了時間の計算に使う、1分あたりに読む文字数")
+)
+
+func main() {
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: novastat [-json] [-cpm 500] input.sce ...")
+		os.Exit(2)
+	}
+
+	reports := []*stat.Report{}
+	for _, path := range flag.Args() {
+		r, err := collect(path)
+		if err != nil {
+			log.Fatalf("%s: %s", path, err)
+		}
+		reports = append(reports, r)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := r.WriteTable(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func collect(path string) (*stat.Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	program, err := parser.NewParser(lexer.NewLexerFromReader(f)).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	e := event.NewEvaluator()
+	e.Eval(program)
+	r, err := stat.Collect(e, *cpm)
+	if err != nil {
+		return nil, err
+	}
+	r.File = path
+
+	return r, nil
+}
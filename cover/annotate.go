@@ -0,0 +1,184 @@
+package cover
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+)
+
+// 行の状態
+type Status int
+
+const (
+	// イベントのない行。空行やコメントなど
+	Neutral Status = iota
+	// 行にあるイベントをすべて実行した
+	Covered
+	// 行にあるイベントの一部だけを実行した
+	Partial
+	// 行にあるイベントを1つも実行しなかった
+	Uncovered
+)
+
+// 注釈つきのソースの1行
+type Line struct {
+	// 1始まりの行番号
+	Number int
+	Text   string
+	Status Status
+	// 行にあるイベントの実行回数の最大値。ラベル定義の行では、ラベル内のイベントの実行回数の最大値
+	Count int
+}
+
+// シナリオのソースの各行に、実行したかどうかの注釈をつける
+// ラベル定義の行は、ラベル内のイベントを1つでも実行していれば通ったとみなす
+func Annotate(src string, p *Profile) ([]Line, error) {
+	program, err := parser.NewParser(lexer.NewLexer(src)).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	labelLines := map[int]string{}
+	for _, stmt := range program.Statements {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		if label, ok := es.Expression.(*ast.LabelLiteral); ok {
+			labelLines[label.Token.Pos.Line] = label.LabelName.Value
+		}
+	}
+	labelCount := map[string]int{}
+	for _, b := range p.Blocks {
+		if b.Count >= labelCount[b.Label] {
+			labelCount[b.Label] = b.Count
+		}
+	}
+
+	blocks := p.lines()
+	result := []Line{}
+	for i, text := range strings.Split(strings.TrimSuffix(src, "\n"), "\n") {
+		line := Line{Number: i + 1, Text: text}
+		if name, ok := labelLines[line.Number]; ok {
+			if count, ok := labelCount[name]; ok {
+				line.Count = count
+				line.Status = Uncovered
+				if count > 0 {
+					line.Status = Covered
+				}
+			}
+		} else if bs, ok := blocks[line.Number]; ok {
+			line.Status = status(bs)
+			for _, b := range bs {
+				if b.Count > line.Count {
+					line.Count = b.Count
+				}
+			}
+		}
+		result = append(result, line)
+	}
+
+	return result, nil
+}
+
+func status(bs []Block) Status {
+	covered := 0
+	for _, b := range bs {
+		if b.Count > 0 {
+			covered++
+		}
+	}
+	switch covered {
+	case 0:
+		return Uncovered
+	case len(bs):
+		return Covered
+	}
+
+	return Partial
+}
+
+// 行ごとに、実行回数と状態の記号をつけて書き込む
+// 実行しなかった行には!、一部だけ実行した行には~をつける
+func WriteText(w io.Writer, lines []Line) error {
+	var out strings.Builder
+	for _, l := range lines {
+		count := ""
+		mark := " "
+		switch l.Status {
+		case Covered:
+			count = strconv.Itoa(l.Count)
+		case Partial:
+			count = strconv.Itoa(l.Count)
+			mark = "~"
+		case Uncovered:
+			count = "0"
+			mark = "!"
+		}
+		fmt.Fprintf(&out, "%5d %6s %s| %s\n", l.Number, count, mark, l.Text)
+	}
+	_, err := io.WriteString(w, out.String())
+
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("cover").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { background: #fff; color: #333; font-family: monospace; }
+table { border-collapse: collapse; }
+td { padding: 0 8px; white-space: pre; vertical-align: top; }
+td.num { color: #999; text-align: right; }
+.covered { background: #dfd; }
+.partial { background: #ffd; }
+.uncovered { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}</p>
+<table>
+{{- range .Lines}}
+<tr class="{{.Class}}"><td class="num">{{.Number}}</td><td class="num">{{.Count}}</td><td>{{.Text}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// 行ごとに、状態で色分けしたHTMLを書き込む
+func WriteHTML(w io.Writer, title string, summary Summary, lines []Line) error {
+	type row struct {
+		Number int
+		Count  string
+		Text   string
+		Class  string
+	}
+	rows := []row{}
+	for _, l := range lines {
+		r := row{Number: l.Number, Text: l.Text}
+		switch l.Status {
+		case Covered:
+			r.Class, r.Count = "covered", strconv.Itoa(l.Count)
+		case Partial:
+			r.Class, r.Count = "partial", strconv.Itoa(l.Count)
+		case Uncovered:
+			r.Class, r.Count = "uncovered", "0"
+		}
+		rows = append(rows, r)
+	}
+
+	return htmlTemplate.Execute(w, struct {
+		Title   string
+		Summary string
+		Lines   []row
+	}{title, summary.String(), rows})
+}
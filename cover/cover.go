@@ -0,0 +1,312 @@
+// シナリオのカバレッジを扱うパッケージ
+// キューが記録した実行回数を、Goのcoverprofileと同じ形式で読み書きし、ソースに注釈をつけて表示する
+//
+//	mode: count
+//	ファイル名:開始行.開始列,終了行.終了列 1 実行回数
+//
+// 1行が1イベントに対応する。実行されなかったイベントも回数0で書き込む
+// イベントの範囲は、ラベル内の次のイベントの位置までとする。ラベルの最後のイベントは開始位置だけを指す
+// ファイル名を含むので、複数のシナリオの記録を1つにまとめても混ざらない
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+)
+
+// 記録の形式。実行回数を数える
+const Mode = "count"
+
+// 1イベントの実行回数
+type Block struct {
+	// シナリオのファイル名
+	File string
+	// イベントのあるラベル。記録には書き込まないので、読み込んだあとはResolveLabelsで埋める
+	Label     string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Count     int
+}
+
+// カバレッジの記録
+type Profile struct {
+	// ラベルの定義順、ラベル内ではイベントの順に並べる
+	Blocks []Block
+}
+
+// 評価器のすべてのラベルについて、キューが記録した実行回数をまとめる
+// fileは評価器に読み込んだシナリオのファイル名
+func NewProfile(file string, e *event.Evaluator, c *event.Coverage) (*Profile, error) {
+	labels, err := e.CompileAll()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{Blocks: []Block{}}
+	for _, label := range labels {
+		for i, pos := range label.Positions {
+			end := pos
+			if i+1 < len(label.Positions) {
+				end = label.Positions[i+1]
+			}
+			p.Blocks = append(p.Blocks, Block{
+				File:      file,
+				Label:     label.Name,
+				Line:      pos.Line,
+				Column:    pos.Column,
+				EndLine:   end.Line,
+				EndColumn: end.Column,
+				Count:     c.EventCount(label.Name, i),
+			})
+		}
+	}
+
+	return p, nil
+}
+
+// 書き込まれた記録を読み込む
+func ParseProfile(r io.Reader) (*Profile, error) {
+	s := bufio.NewScanner(r)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("カバレッジの記録が空")
+	}
+	if s.Text() != "mode: "+Mode {
+		return nil, fmt.Errorf("1行目: 対応していない形式: %q", s.Text())
+	}
+
+	p := &Profile{Blocks: []Block{}}
+	for n := 2; s.Scan(); n++ {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		b, err := parseBlock(line)
+		if err != nil {
+			return nil, fmt.Errorf("%d行目: %w", n, err)
+		}
+		p.Blocks = append(p.Blocks, b)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ファイル名:開始行.開始列,終了行.終了列 文の数 実行回数
+func parseBlock(line string) (Block, error) {
+	invalid := fmt.Errorf("不正な行: %q", line)
+
+	fields := strings.Split(line, " ")
+	if len(fields) < 3 {
+		return Block{}, invalid
+	}
+	loc := strings.Join(fields[:len(fields)-2], " ")
+	colon := strings.LastIndex(loc, ":")
+	if colon < 0 {
+		return Block{}, invalid
+	}
+	pos := strings.SplitN(loc[colon+1:], ",", 2)
+	if len(pos) != 2 {
+		return Block{}, invalid
+	}
+	l, c, err1 := parsePos(pos[0])
+	el, ec, err2 := parsePos(pos[1])
+	_, err3 := strconv.Atoi(fields[len(fields)-2])
+	count, err4 := strconv.Atoi(fields[len(fields)-1])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return Block{}, invalid
+	}
+
+	return Block{File: loc[:colon], Line: l, Column: c, EndLine: el, EndColumn: ec, Count: count}, nil
+}
+
+// 行.列
+func parsePos(s string) (int, int, error) {
+	lc := strings.SplitN(s, ".", 2)
+	if len(lc) != 2 {
+		return 0, 0, fmt.Errorf("不正な位置: %q", s)
+	}
+	l, err := strconv.Atoi(lc[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	c, err := strconv.Atoi(lc[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return l, c, nil
+}
+
+// 記録を書き込む
+func (p *Profile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", Mode)
+	for _, b := range p.Blocks {
+		// 1イベントを1文として数える
+		fmt.Fprintf(bw, "%s:%d.%d,%d.%d 1 %d\n", b.File, b.Line, b.Column, b.EndLine, b.EndColumn, b.Count)
+	}
+
+	return bw.Flush()
+}
+
+// 別の記録の実行回数を足し合わせる。同じシナリオを何度か遊んだ記録をまとめるのに使う
+func (p *Profile) Merge(other *Profile) {
+	index := map[Block]int{}
+	for i, b := range p.Blocks {
+		index[b.key()] = i
+	}
+	for _, b := range other.Blocks {
+		if i, ok := index[b.key()]; ok {
+			p.Blocks[i].Count += b.Count
+			continue
+		}
+		index[b.key()] = len(p.Blocks)
+		p.Blocks = append(p.Blocks, b)
+	}
+}
+
+// 実行回数を除いた、イベントを識別する値。ラベルは読み込んだ記録にはないので使わない
+func (b Block) key() Block {
+	b.Label = ""
+	b.Count = 0
+	return b
+}
+
+// ファイルのイベントだけを取り出す。ファイル名は整えてから比べる
+func (p *Profile) File(file string) *Profile {
+	result := &Profile{Blocks: []Block{}}
+	for _, b := range p.Blocks {
+		if filepath.Clean(b.File) == filepath.Clean(file) {
+			result.Blocks = append(result.Blocks, b)
+		}
+	}
+
+	return result
+}
+
+// ソースのラベル定義から、各イベントのラベルを埋める。イベントより前にある一番近いラベルを使う
+// 記録はsrcのファイルのイベントだけにしておく
+func (p *Profile) ResolveLabels(src string) error {
+	program, err := parser.NewParser(lexer.NewLexer(src)).ParseProgram()
+	if err != nil {
+		return err
+	}
+	labels := []*ast.LabelLiteral{}
+	for _, stmt := range program.Statements {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		if label, ok := es.Expression.(*ast.LabelLiteral); ok {
+			labels = append(labels, label)
+		}
+	}
+
+	for i, b := range p.Blocks {
+		p.Blocks[i].Label = ""
+		for _, label := range labels {
+			pos := label.Token.Pos
+			if pos.Line > b.Line || (pos.Line == b.Line && pos.Column > b.Column) {
+				break
+			}
+			p.Blocks[i].Label = label.LabelName.Value
+		}
+	}
+
+	return nil
+}
+
+// カバレッジの集計
+type Summary struct {
+	Events        int
+	CoveredEvents int
+	Labels        int
+	CoveredLabels int
+}
+
+// イベントを1つでも実行したラベルを、通ったラベルとして数える
+func (p *Profile) Summary() Summary {
+	s := Summary{}
+	labels := map[string]bool{}
+	for _, b := range p.Blocks {
+		s.Events++
+		if b.Count > 0 {
+			s.CoveredEvents++
+		}
+		labels[b.Label] = labels[b.Label] || b.Count > 0
+	}
+	s.Labels = len(labels)
+	for _, covered := range labels {
+		if covered {
+			s.CoveredLabels++
+		}
+	}
+
+	return s
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("イベント %d/%d (%s), ラベル %d/%d (%s)",
+		s.CoveredEvents, s.Events, percent(s.CoveredEvents, s.Events),
+		s.CoveredLabels, s.Labels, percent(s.CoveredLabels, s.Labels),
+	)
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+
+	return strconv.FormatFloat(float64(n)/float64(total)*100, 'f', 1, 64) + "%"
+}
+
+// 通らなかったラベルを定義順に返す
+func (p *Profile) UncoveredLabels() []string {
+	order := []string{}
+	covered := map[string]bool{}
+	for _, b := range p.Blocks {
+		if _, ok := covered[b.Label]; !ok {
+			order = append(order, b.Label)
+		}
+		covered[b.Label] = covered[b.Label] || b.Count > 0
+	}
+
+	result := []string{}
+	for _, l := range order {
+		if !covered[l] {
+			result = append(result, l)
+		}
+	}
+
+	return result
+}
+
+// 行ごとの実行回数。同じ行に複数のイベントがあるときは、列の順に並べる
+func (p *Profile) lines() map[int][]Block {
+	result := map[int][]Block{}
+	for _, b := range p.Blocks {
+		result[b.Line] = append(result[b.Line], b)
+	}
+	for _, bs := range result {
+		sort.Slice(bs, func(i, j int) bool { return bs[i].Column < bs[j].Column })
+	}
+
+	return result
+}
@@ -0,0 +1,165 @@
+package cover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `*start
+目が覚めた。[l]
+; コメント
+[jump target="outside"]
+*outside
+空が青い。[p]
+*sleep
+眠い。[p]`
+
+// startから最後まで実行した記録を作る
+func record(t *testing.T, input string) *Profile {
+	t.Helper()
+
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	q := event.NewQueue(e)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Coverage = event.NewCoverage()
+	q.Start()
+	for q.Wait(); !q.Ended(); q.Wait() {
+		q.Run()
+	}
+
+	p, err := NewProfile("scenario.sce", e, q.Coverage)
+	assert.NoError(t, err)
+
+	return p
+}
+
+func TestNewProfile_実行回数をまとめる(t *testing.T) {
+	p := record(t, input)
+
+	assert.Equal(t, []Block{
+		{File: "scenario.sce", Label: "start", Line: 2, Column: 1, EndLine: 2, EndColumn: 7, Count: 1},
+		{File: "scenario.sce", Label: "start", Line: 2, Column: 7, EndLine: 4, EndColumn: 1, Count: 1},
+		{File: "scenario.sce", Label: "start", Line: 4, Column: 1, EndLine: 4, EndColumn: 1, Count: 1},
+		{File: "scenario.sce", Label: "outside", Line: 6, Column: 1, EndLine: 6, EndColumn: 6, Count: 1},
+		{File: "scenario.sce", Label: "outside", Line: 6, Column: 6, EndLine: 6, EndColumn: 6, Count: 1},
+		{File: "scenario.sce", Label: "sleep", Line: 8, Column: 1, EndLine: 8, EndColumn: 4, Count: 0},
+		{File: "scenario.sce", Label: "sleep", Line: 8, Column: 4, EndLine: 8, EndColumn: 4, Count: 0},
+	}, p.Blocks)
+}
+
+func TestWrite_読み込むと元に戻る(t *testing.T) {
+	p := record(t, input)
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.Write(&buf))
+	assert.True(t, strings.HasPrefix(buf.String(), "mode: count\nscenario.sce:2.1,2.7 1 1\n"))
+
+	result, err := ParseProfile(&buf)
+	assert.NoError(t, err)
+	assert.NoError(t, result.ResolveLabels(input))
+	assert.Equal(t, p, result)
+}
+
+func TestFile_ファイルごとに分ける(t *testing.T) {
+	p := &Profile{Blocks: []Block{
+		{File: "a.sce", Line: 2, Column: 1, EndLine: 2, EndColumn: 1, Count: 1},
+		{File: "dir/b.sce", Line: 2, Column: 1, EndLine: 2, EndColumn: 1, Count: 0},
+	}}
+	p.Merge(&Profile{Blocks: []Block{
+		{File: "dir/b.sce", Line: 2, Column: 1, EndLine: 2, EndColumn: 1, Count: 2},
+	}})
+
+	assert.Equal(t, []Block{
+		{File: "a.sce", Line: 2, Column: 1, EndLine: 2, EndColumn: 1, Count: 1},
+	}, p.File("./a.sce").Blocks)
+	assert.Equal(t, []Block{
+		{File: "dir/b.sce", Line: 2, Column: 1, EndLine: 2, EndColumn: 1, Count: 2},
+	}, p.File("dir/b.sce").Blocks)
+}
+
+func TestParseProfile_不正な記録はエラーになる(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"空", "", "カバレッジの記録が空"},
+		{"形式が違う", "mode: set\n", `1行目: 対応していない形式: "mode: set"`},
+		{"回数がない", "mode: count\na.sce:2.1,2.7 1\n", `2行目: 不正な行: "a.sce:2.1,2.7 1"`},
+		{"位置が不正", "mode: count\na.sce:2.1 1 1\n", `2行目: 不正な行: "a.sce:2.1 1 1"`},
+		{"ファイル名がない", "mode: count\n2.1,2.7 1 1\n", `2行目: 不正な行: "2.1,2.7 1 1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseProfile(strings.NewReader(tt.input))
+			assert.EqualError(t, err, tt.expect)
+		})
+	}
+}
+
+func TestMerge_実行回数を足し合わせる(t *testing.T) {
+	p := &Profile{Blocks: []Block{
+		{File: "a.sce", Line: 2, Column: 1, Count: 1},
+		{File: "a.sce", Line: 8, Column: 1, Count: 0},
+	}}
+	p.Merge(&Profile{Blocks: []Block{
+		{File: "a.sce", Line: 8, Column: 1, Count: 2},
+		{File: "b.sce", Line: 8, Column: 1, Count: 1},
+	}})
+
+	assert.Equal(t, []Block{
+		{File: "a.sce", Line: 2, Column: 1, Count: 1},
+		{File: "a.sce", Line: 8, Column: 1, Count: 2},
+		{File: "b.sce", Line: 8, Column: 1, Count: 1},
+	}, p.Blocks)
+}
+
+func TestSummary_イベントとラベルを数える(t *testing.T) {
+	p := record(t, input)
+
+	assert.Equal(t, Summary{Events: 7, CoveredEvents: 5, Labels: 3, CoveredLabels: 2}, p.Summary())
+	assert.Equal(t, "イベント 5/7 (71.4%), ラベル 2/3 (66.7%)", p.Summary().String())
+	assert.Equal(t, []string{"sleep"}, p.UncoveredLabels())
+}
+
+func TestWriteText_行ごとに注釈をつける(t *testing.T) {
+	p := record(t, input)
+	p.Blocks[1].Count = 0
+	lines, err := Annotate(input, p)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteText(&buf, lines))
+	assert.Equal(t, `    1      1  | *start
+    2      1 ~| 目が覚めた。[l]
+    3         | ; コメント
+    4      1  | [jump target="outside"]
+    5      1  | *outside
+    6      1  | 空が青い。[p]
+    7      0 !| *sleep
+    8      0 !| 眠い。[p]
+`, buf.String())
+}
+
+func TestWriteHTML_状態で色分けする(t *testing.T) {
+	p := record(t, input)
+	lines, err := Annotate(input, p)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteHTML(&buf, "scenario.sce", p.Summary(), lines))
+	assert.Contains(t, buf.String(), `<tr class="covered"><td class="num">6</td><td class="num">1</td><td>空が青い。[p]</td></tr>`)
+	assert.Contains(t, buf.String(), `<tr class="uncovered"><td class="num">8</td><td class="num">0</td><td>眠い。[p]</td></tr>`)
+	assert.Contains(t, buf.String(), `<td>[jump target=&#34;outside&#34;]</td>`)
+}
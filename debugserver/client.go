@@ -0,0 +1,116 @@
+package debugserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// デバッグサーバーを操作するクライアント
+type Client struct {
+	// サーバーのURL。例: http://localhost:6060
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// アドレスにスキームがないときは、httpとみなす
+func NewClient(addr string) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &Client{BaseURL: strings.TrimSuffix(addr, "/"), HTTP: http.DefaultClient}
+}
+
+func (c *Client) State() (*State, error) {
+	st := &State{}
+	if err := c.do(http.MethodGet, "/state", nil, st); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (c *Client) Pause() (*State, error) {
+	return c.action("/pause", nil)
+}
+
+func (c *Client) Continue() (*State, error) {
+	return c.action("/continue", nil)
+}
+
+func (c *Client) Step() (*State, error) {
+	return c.action("/step", nil)
+}
+
+// クリックしたときと同じく進める
+func (c *Client) Click() (*State, error) {
+	return c.action("/click", nil)
+}
+
+func (c *Client) Jump(label string) (*State, error) {
+	return c.action("/jump", jumpRequest{Label: label})
+}
+
+func (c *Client) Breakpoints() ([]Breakpoint, error) {
+	result := []Breakpoint{}
+	if err := c.do(http.MethodGet, "/breakpoints", nil, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ブレークポイントをすべて置き換える
+func (c *Client) SetBreakpoints(breakpoints []Breakpoint) error {
+	return c.do(http.MethodPut, "/breakpoints", breakpoints, nil)
+}
+
+func (c *Client) action(path string, body any) (*State, error) {
+	st := &State{}
+	if err := c.do(http.MethodPost, path, body, st); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (c *Client) do(method string, path string, body any, result any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return errors.New(e.Error)
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,344 @@
+// 実行中のキューを外から調べるためのデバッグサーバーのパッケージ
+// localhostでHTTP/JSONを受け付け、状態の表示、ラベルへの移動、ブレークポイント、1イベントずつの実行を提供する
+// シナリオには変数や呼び出しスタックがないので、代わりに再生したラベルの履歴を返す
+package debugserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/kijimaD/nova/event"
+)
+
+// 保持する直近のイベントの数
+const recentSize = 50
+
+// 一時停止した理由
+const (
+	ReasonPause      = event.PauseReasonPause
+	ReasonStep       = event.PauseReasonStep
+	ReasonBreakpoint = event.PauseReasonBreakpoint
+	ReasonWatch      = event.PauseReasonWatch
+)
+
+// ラベルの先頭か、行か、コマンドの前で止める。どれか1つを指定する
+type Breakpoint struct {
+	Label string `json:"label,omitempty"`
+	// 1始まりの行番号
+	Line    int    `json:"line,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// 実行したイベント
+type Record struct {
+	Label string `json:"label"`
+	Index int    `json:"index"`
+	Line  int    `json:"line"`
+	Event string `json:"event"`
+}
+
+// キューの状態
+type State struct {
+	// 実行中のイベントの位置
+	Label string `json:"label"`
+	Index int    `json:"index"`
+	Line  int    `json:"line"`
+	Event string `json:"event"`
+	// ラベル内で、実行中のイベントより後ろのイベント
+	Waiting []string `json:"waiting"`
+	Display string   `json:"display"`
+	Choices []string `json:"choices"`
+	Ended   bool     `json:"ended"`
+	Paused  bool     `json:"paused"`
+	Reason  string   `json:"reason,omitempty"`
+	// 再生したラベルの履歴。古い順
+	History []string `json:"history"`
+	// 直近に実行したイベント。古い順
+	Recent      []Record     `json:"recent"`
+	Breakpoints []Breakpoint `json:"breakpoints"`
+}
+
+// キューに取り付けるデバッグサーバー
+// 一時停止とブレークポイントは、キューのevent.Debuggerを使う
+type Server struct {
+	q   *event.Queue
+	d   *event.Debugger
+	mux *http.ServeMux
+
+	mu          sync.Mutex
+	breakpoints []Breakpoint
+	history     []string
+	recent      []Record
+}
+
+// キューのフックとデバッガーに取り付ける。Start()の前に呼ぶ
+// すでに設定されているフックも続けて呼ぶ。デバッガーが設定されていなければ作る
+func NewServer(q *event.Queue) *Server {
+	if q.Debugger == nil {
+		q.Debugger = event.NewDebugger()
+	}
+	s := &Server{q: q, d: q.Debugger, mux: http.NewServeMux(), breakpoints: []Breakpoint{}, history: []string{}, recent: []Record{}}
+
+	prev := q.Hooks
+	q.Hooks.OnPlay = func(label string) {
+		s.onPlay(label)
+		if prev.OnPlay != nil {
+			prev.OnPlay(label)
+		}
+	}
+	q.Hooks.OnEvent = func(e event.Event) {
+		if prev.OnEvent != nil {
+			prev.OnEvent(e)
+		}
+		s.onEvent(e)
+	}
+
+	s.mux.HandleFunc("/state", s.handleState)
+	s.mux.HandleFunc("/pause", s.post(s.Pause))
+	s.mux.HandleFunc("/continue", s.post(s.Continue))
+	s.mux.HandleFunc("/step", s.post(s.Step))
+	s.mux.HandleFunc("/click", s.post(func() error {
+		s.q.Run()
+		return nil
+	}))
+	s.mux.HandleFunc("/jump", s.handleJump)
+	s.mux.HandleFunc("/breakpoints", s.handleBreakpoints)
+
+	return s
+}
+
+// localhostのアドレスで待ち受ける。例: localhost:6060
+// 誰でもゲームを操作できてしまうので、ループバック以外のアドレスはエラーにする
+func (s *Server) ListenAndServe(addr string) error {
+	if err := checkLoopback(addr); err != nil {
+		return err
+	}
+
+	return http.ListenAndServe(addr, s)
+}
+
+// アドレスのホストがlocalhostか、ループバックのIPアドレスかを確かめる。空のホストはすべてのアドレスを意味するので受け付けない
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("ループバック以外のアドレスでは待ち受けない: %q", addr)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// 一時停止を解除し、以降は止めない
+func (s *Server) Close() {
+	s.d.Detach()
+}
+
+func (s *Server) onPlay(label string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = append(s.history, label)
+}
+
+// イベントの実行前に呼ばれる。止めるかどうかはデバッガーが判断する
+func (s *Server) onEvent(e event.Event) {
+	cur := s.q.Snapshot()
+	rec := Record{Label: cur.Label, Index: cur.Index, Line: cur.Pos.Line, Event: e.String()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recent = append(s.recent, rec)
+	if len(s.recent) > recentSize {
+		s.recent = s.recent[len(s.recent)-recentSize:]
+	}
+}
+
+// 次のイベントの実行前に止める
+func (s *Server) Pause() error {
+	s.d.Pause()
+
+	return nil
+}
+
+// 一時停止を解除する
+func (s *Server) Continue() error {
+	s.d.Resume()
+
+	return nil
+}
+
+// 1イベントだけ実行して止める
+// 一時停止中でないときは、クリックして次のイベントに進める
+func (s *Server) Step() error {
+	_, paused := s.d.Paused()
+	s.d.Step()
+	if !paused {
+		s.q.Run()
+	}
+
+	return nil
+}
+
+// ラベルの先頭へ移動する。クリック待ちか選択待ちのときだけ移動できる
+func (s *Server) Jump(label string) error {
+	if _, paused := s.d.Paused(); paused {
+		return errors.New("一時停止中は移動できない。再開してクリック待ちにする")
+	}
+
+	return s.q.Goto(label)
+}
+
+// ブレークポイントをすべて置き換える
+func (s *Server) SetBreakpoints(breakpoints []Breakpoint) error {
+	converted := []event.Breakpoint{}
+	for _, b := range breakpoints {
+		n := 0
+		for _, set := range []bool{b.Label != "", b.Line != 0, b.Command != ""} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("ラベル、行、コマンドのどれか1つを指定する: %+v", b)
+		}
+		converted = append(converted, event.Breakpoint{Label: b.Label, Line: b.Line, Command: b.Command})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.breakpoints = append([]Breakpoint{}, breakpoints...)
+	s.d.SetBreakpoints(converted)
+
+	return nil
+}
+
+// 現在の状態を返す
+func (s *Server) State() State {
+	cur := s.q.Snapshot()
+	st := State{
+		Label:   cur.Label,
+		Index:   cur.Index,
+		Line:    cur.Pos.Line,
+		Waiting: []string{},
+		Display: s.q.Display(),
+		Choices: []string{},
+		Ended:   s.q.Ended(),
+	}
+	if cur.Event != nil {
+		st.Event = cur.Event.String()
+	}
+	for _, e := range cur.Rest {
+		st.Waiting = append(st.Waiting, e.String())
+	}
+	for _, c := range s.q.Choices() {
+		st.Choices = append(st.Choices, fmt.Sprintf("%s -> %s", c.Text, c.Target))
+	}
+
+	if p, ok := s.d.Paused(); ok {
+		st.Paused = true
+		st.Reason = p.Reason
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st.History = append([]string{}, s.history...)
+	st.Recent = append([]Record{}, s.recent...)
+	st.Breakpoints = append([]Breakpoint{}, s.breakpoints...)
+
+	return st
+}
+
+// エラーの応答
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("対応していないメソッド: %s", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.State())
+}
+
+// 本文のないPOSTの操作を受け付ける
+func (s *Server) post(f func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("対応していないメソッド: %s", r.Method))
+			return
+		}
+		if err := f(); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.State())
+	}
+}
+
+type jumpRequest struct {
+	Label string `json:"label"`
+}
+
+func (s *Server) handleJump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("対応していないメソッド: %s", r.Method))
+		return
+	}
+	var req jumpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.Jump(req.Label); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.State())
+}
+
+func (s *Server) handleBreakpoints(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.State().Breakpoints)
+	case http.MethodPut:
+		breakpoints := []Breakpoint{}
+		if err := json.NewDecoder(r.Body).Decode(&breakpoints); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.SetBreakpoints(breakpoints); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.State().Breakpoints)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("対応していないメソッド: %s", r.Method))
+	}
+}
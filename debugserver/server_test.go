@@ -0,0 +1,200 @@
+package debugserver
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/loader"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepare(t *testing.T, input string) (*Client, *Server, *event.Queue) {
+	t.Helper()
+
+	q, err := loader.NewQueueFromText(input)
+	assert.NoError(t, err)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	s := NewServer(q)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Close()
+		ts.Close()
+	})
+
+	return NewClient(ts.URL), s, q
+}
+
+// 一時停止するまで待つ
+func waitPaused(t *testing.T, c *Client) *State {
+	t.Helper()
+
+	var st *State
+	assert.Eventually(t, func() bool {
+		var err error
+		st, err = c.State()
+		return err == nil && st.Paused
+	}, time.Second, time.Millisecond)
+
+	return st
+}
+
+const input = `*start
+あ[p]
+[jump target="next"]
+*next
+い
+う[p]
+`
+
+func TestServer_状態を返す(t *testing.T) {
+	c, _, q := prepare(t, input)
+	q.Start()
+	q.Wait()
+
+	st, err := c.State()
+	assert.NoError(t, err)
+	assert.Equal(t, "start", st.Label)
+	assert.Equal(t, 1, st.Index)
+	assert.Equal(t, 2, st.Line)
+	assert.Equal(t, "<Flush>", st.Event)
+	assert.Equal(t, []string{"<Jump next>"}, st.Waiting)
+	assert.Equal(t, "あ", st.Display)
+	assert.Equal(t, []string{"start"}, st.History)
+	assert.Equal(t, []Record{
+		{Label: "start", Index: 0, Line: 2, Event: "<MsgEmit あ>"},
+		{Label: "start", Index: 1, Line: 2, Event: "<Flush>"},
+	}, st.Recent)
+	assert.False(t, st.Paused)
+}
+
+func TestServer_ラベルのブレークポイントで止まる(t *testing.T) {
+	c, _, q := prepare(t, input)
+	assert.NoError(t, c.SetBreakpoints([]Breakpoint{{Label: "next"}}))
+	q.Start()
+	q.Wait()
+
+	_, err := c.Click()
+	assert.NoError(t, err)
+	st := waitPaused(t, c)
+	assert.Equal(t, ReasonBreakpoint, st.Reason)
+	assert.Equal(t, "next", st.Label)
+	assert.Equal(t, 0, st.Index)
+	assert.Equal(t, "", st.Display)
+
+	_, err = c.Continue()
+	assert.NoError(t, err)
+	q.Wait()
+	assert.Equal(t, "いう", q.Display())
+}
+
+func TestServer_行のブレークポイントで止まり1イベントずつ進める(t *testing.T) {
+	c, _, q := prepare(t, input)
+	assert.NoError(t, c.SetBreakpoints([]Breakpoint{{Line: 5}}))
+	q.Start()
+	q.Wait()
+
+	_, err := c.Click()
+	assert.NoError(t, err)
+	st := waitPaused(t, c)
+	assert.Equal(t, 5, st.Line)
+	assert.Equal(t, "<MsgEmit い>", st.Event)
+
+	_, err = c.Step()
+	assert.NoError(t, err)
+	st = waitPaused(t, c)
+	assert.Equal(t, ReasonStep, st.Reason)
+	assert.Equal(t, "<MsgEmit う>", st.Event)
+	assert.Equal(t, "い", st.Display)
+
+	_, err = c.Continue()
+	assert.NoError(t, err)
+	q.Wait()
+	assert.Equal(t, "いう", q.Display())
+}
+
+func TestServer_一時停止する(t *testing.T) {
+	c, _, q := prepare(t, input)
+	q.Start()
+	q.Wait()
+
+	_, err := c.Pause()
+	assert.NoError(t, err)
+	_, err = c.Click()
+	assert.NoError(t, err)
+	st := waitPaused(t, c)
+	assert.Equal(t, ReasonPause, st.Reason)
+	assert.Equal(t, "<Jump next>", st.Event)
+
+	// 一時停止中は移動できない
+	_, err = c.Jump("start")
+	assert.Error(t, err)
+}
+
+func TestServer_ラベルへ移動する(t *testing.T) {
+	c, _, q := prepare(t, input)
+	q.Start()
+	q.Wait()
+
+	_, err := c.Jump("next")
+	assert.NoError(t, err)
+	q.Wait()
+	assert.Equal(t, "いう", q.Display())
+
+	_, err = c.Jump("not exists")
+	assert.EqualError(t, err, `指定ラベルが存在しない "not exists"`)
+}
+
+func TestServer_不正なブレークポイントは設定しない(t *testing.T) {
+	c, _, _ := prepare(t, input)
+
+	assert.Error(t, c.SetBreakpoints([]Breakpoint{{Label: "start", Line: 1}}))
+	breakpoints, err := c.Breakpoints()
+	assert.NoError(t, err)
+	assert.Equal(t, []Breakpoint{}, breakpoints)
+}
+
+func TestServer_コマンドの前で止まる(t *testing.T) {
+	c, _, q := prepare(t, input)
+	assert.NoError(t, c.SetBreakpoints([]Breakpoint{{Command: "jump"}}))
+	q.Start()
+	q.Wait()
+
+	_, err := c.Click()
+	assert.NoError(t, err)
+	st := waitPaused(t, c)
+	assert.Equal(t, "<Jump next>", st.Event)
+	assert.Equal(t, []Breakpoint{{Command: "jump"}}, st.Breakpoints)
+}
+
+func TestListenAndServe_ループバック以外のアドレスは拒否する(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"localhost:6060", true},
+		{"127.0.0.1:6060", true},
+		{"[::1]:6060", true},
+		{":6060", false},
+		{"0.0.0.0:6060", false},
+		{"192.168.0.1:6060", false},
+		{"example.com:6060", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := checkLoopback(tt.addr)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	_, s, _ := prepare(t, "*start\nあ[p]")
+	assert.EqualError(t, s.ListenAndServe(":0"), `ループバック以外のアドレスでは待ち受けない: ":0"`)
+}
@@ -0,0 +1,33 @@
+package event
+
+import "time"
+
+// メッセージ表示まわりの設定
+// キューごとに保持するので、同じプロセスの別のキューには影響しない
+// 設定画面などから、実行中に変更できる。シナリオの[delay]は設定を書き換えず、文字を表示するときに合わせる
+type Config struct {
+	// 1行あたりの文字数。全角1文字を1、半角1文字を0.5として数える
+	// Measurerが指定されているときは使わない
+	LineLen int
+	// 文字の描画幅を測る。指定するとLineWidthを超えないように折り返す
+	Measurer Measurer
+	// メッセージウィンドウの幅。Measurerと同じ単位で指定する
+	LineWidth float64
+	// trueのときは句読点を行末にぶら下げる。falseのときは前の文字ごと次の行に送る
+	Hanging bool
+	// 1文字表示するごとに待つ時間
+	MessageSpeed time.Duration
+	// trueのときは文字送りせず、一気に表示する
+	Instant bool
+	// クリック待ちになってから自動で進めるまでの時間。0のときは自動で進めない
+	AutoAdvance time.Duration
+	// trueのときは[wait]で待たない。自動で通して実行するときに使う
+	SkipWait bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		LineLen:      24,
+		MessageSpeed: 20 * time.Millisecond,
+	}
+}
@@ -0,0 +1,53 @@
+package event
+
+import "sync"
+
+// 再生したラベルと実行したイベントの回数を記録する
+// 複数のキューで共有して、まとめて記録できる
+type Coverage struct {
+	mu sync.Mutex
+	// ラベル名ごとの再生回数
+	labels map[string]int
+	// ラベル名ごとの、ラベル内の番号ごとのイベントの実行回数
+	events map[string]map[int]int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{
+		labels: map[string]int{},
+		events: map[string]map[int]int{},
+	}
+}
+
+func (c *Coverage) play(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.labels[label]++
+}
+
+func (c *Coverage) hit(label string, index int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.events[label] == nil {
+		c.events[label] = map[int]int{}
+	}
+	c.events[label][index]++
+}
+
+// ラベルを再生した回数を返す
+func (c *Coverage) LabelCount(label string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.labels[label]
+}
+
+// ラベル内のindex番目のイベントを実行した回数を返す
+func (c *Coverage) EventCount(label string, index int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.events[label][index]
+}
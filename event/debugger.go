@@ -0,0 +1,258 @@
+package event
+
+import (
+	"sync"
+
+	"github.com/kijimaD/nova/token"
+)
+
+// 一時停止した理由
+const (
+	// Pause()による停止
+	PauseReasonPause = "pause"
+	// Step()による停止
+	PauseReasonStep = "step"
+	// ブレークポイントによる停止
+	PauseReasonBreakpoint = "breakpoint"
+	// 監視している値の変化による停止
+	PauseReasonWatch = "watch"
+)
+
+// 止める条件。指定した項目のうち、1つを使う
+type Breakpoint struct {
+	// ラベルの最初のイベントで止める
+	Label string
+	// ソース上の行の最初のイベントで止める。1始まり
+	Line int
+	// コマンドを実行する前に止める。jumpなど、[]の中の名前で指定する
+	Command string
+	// 値が前のイベントのときから変わったら止める
+	// シナリオには変数がないので、キューから取り出した任意の値を監視する。ワーカーのゴルーチンから呼ぶ
+	Watch func(q *Queue) string
+}
+
+// 一時停止したときの状態
+type Paused struct {
+	Reason string
+	// 実行しようとしているイベントと、その位置
+	Label string
+	Index int
+	Pos   token.Position
+	Event Event
+	// ブレークポイントで止まったときの、該当するブレークポイント
+	Breakpoint Breakpoint
+	// 監視している値で止まったときの、変わる前と後の値
+	Old string
+	New string
+}
+
+// キューの実行を、イベントごとに止めたり進めたりする
+// Queue.Debuggerに設定すると、ワーカーがイベントを実行する前に確認する
+type Debugger struct {
+	// 一時停止したときに呼ぶ。ワーカーのゴルーチンから呼び、戻った後もResume()かStep()されるまで止まったままにする
+	// 中でResume()やStep()を呼んでもよい
+	OnPause func(p Paused)
+
+	mu          sync.Mutex
+	breakpoints []Breakpoint
+	// 監視している値の、前のイベントのときの値。breakpointsと同じ順
+	watched []*string
+	// 次のイベントで止める理由。空のときは止めない
+	request string
+	// 一時停止中の状態と、closeすると再開するチャンネル
+	paused *Paused
+	resume chan struct{}
+	// 直前に実行したイベントの位置。同じ行の2つ目以降のイベントでは止めない
+	lastLabel string
+	lastLine  int
+	// Detach()したか
+	detached bool
+}
+
+func NewDebugger() *Debugger {
+	return &Debugger{breakpoints: []Breakpoint{}, watched: []*string{}}
+}
+
+// ブレークポイントをすべて置き換える
+func (d *Debugger) SetBreakpoints(breakpoints []Breakpoint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.breakpoints = append([]Breakpoint{}, breakpoints...)
+	d.watched = make([]*string, len(breakpoints))
+}
+
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]Breakpoint{}, d.breakpoints...)
+}
+
+// 次のイベントを実行する前に止める
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.paused == nil {
+		d.request = PauseReasonPause
+	}
+}
+
+// 一時停止を解除する
+func (d *Debugger) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.request = ""
+	d.release()
+}
+
+// 一時停止中なら、1イベントだけ実行して止める。一時停止中でないときは、次のイベントで止める
+func (d *Debugger) Step() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.request = PauseReasonStep
+	d.release()
+}
+
+// 一時停止中なら、その状態を返す
+func (d *Debugger) Paused() (Paused, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.paused == nil {
+		return Paused{}, false
+	}
+
+	return *d.paused, true
+}
+
+// 一時停止を解除し、以降は止めない
+func (d *Debugger) Detach() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.detached = true
+	d.release()
+}
+
+// 一時停止中なら再開する。ロックを取ってから呼ぶ
+func (d *Debugger) release() {
+	if d.resume == nil {
+		return
+	}
+	close(d.resume)
+	d.resume = nil
+	d.paused = nil
+}
+
+// イベントを実行する前にワーカーから呼ぶ。止めるときは、再開されるまでブロックする
+// 止まっている間にキューを停止したときは、一時停止を解除してfalseを返す
+func (d *Debugger) check(q *Queue, e Event) bool {
+	cur := q.Snapshot()
+	label := cur.Label
+	p := Paused{Label: label, Index: cur.Index, Pos: cur.Pos, Event: e}
+
+	d.mu.Lock()
+	firstOfLine := p.Pos.Line != d.lastLine || label != d.lastLabel
+	d.lastLabel = label
+	d.lastLine = p.Pos.Line
+	if d.detached {
+		d.mu.Unlock()
+		return true
+	}
+	p.Reason = d.request
+	for i, b := range d.breakpoints {
+		if b.Watch != nil {
+			// 止めるかどうかにかかわらず、値を更新しておく
+			value := b.Watch(q)
+			old := d.watched[i]
+			d.watched[i] = &value
+			if p.Reason == "" && old != nil && *old != value {
+				p.Reason = PauseReasonWatch
+				p.Breakpoint = b
+				p.Old = *old
+				p.New = value
+			}
+			continue
+		}
+		if p.Reason == "" && b.hit(p, firstOfLine) {
+			p.Reason = PauseReasonBreakpoint
+			p.Breakpoint = b
+		}
+	}
+	if p.Reason == "" {
+		d.mu.Unlock()
+		return true
+	}
+	d.request = ""
+	resume := make(chan struct{})
+	d.resume = resume
+	d.paused = &p
+	onPause := d.OnPause
+	d.mu.Unlock()
+
+	if onPause != nil {
+		onPause(p)
+	}
+	select {
+	case <-resume:
+		return true
+	case <-q.stopChan:
+		d.mu.Lock()
+		if d.resume == resume {
+			d.release()
+		}
+		d.mu.Unlock()
+		return false
+	}
+}
+
+func (b Breakpoint) hit(p Paused, firstOfLine bool) bool {
+	switch {
+	case b.Label != "":
+		return b.Label == p.Label && p.Index == 0
+	case b.Line != 0:
+		return b.Line == p.Pos.Line && firstOfLine
+	case b.Command != "":
+		return b.Command == CommandName(p.Event)
+	}
+
+	return false
+}
+
+// イベントの元になったコマンド名を返す。本文のときは空文字列を返す
+func CommandName(e Event) string {
+	switch e.(type) {
+	case *Flush:
+		return token.CMD_FLUSH
+	case *LineEndWait:
+		return token.CMD_LINE_END_WAIT
+	case *Newline:
+		return token.CMD_NEWLINE
+	case *ChangeBg:
+		return token.CMD_IMAGE
+	case *Wait:
+		return token.CMD_WAIT
+	case *Jump:
+		return token.CMD_JUMP
+	case *Delay:
+		return token.CMD_DELAY
+	case *Font:
+		return token.CMD_FONT
+	case *ResetFont:
+		return token.CMD_RESET_FONT
+	case *Ruby:
+		return token.CMD_RUBY
+	case *EndRuby:
+		return token.CMD_END_RUBY
+	case *Choice:
+		return token.CMD_CHOICE
+	case *Select:
+		return token.CMD_SELECT
+	}
+
+	return ""
+}
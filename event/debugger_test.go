@@ -0,0 +1,160 @@
+package event
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// デバッガーを取り付けて、一時停止した状態を受け取るチャンネルを返す
+func prepareDebugger(t *testing.T, input string, breakpoints ...Breakpoint) (*Queue, *Debugger, chan Paused) {
+	t.Helper()
+
+	q := prepareQueue(t, input)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	d := NewDebugger()
+	d.SetBreakpoints(breakpoints)
+	paused := make(chan Paused, 10)
+	d.OnPause = func(p Paused) { paused <- p }
+	q.Debugger = d
+	t.Cleanup(d.Detach)
+
+	return q, d, paused
+}
+
+func receive(t *testing.T, paused chan Paused) Paused {
+	t.Helper()
+
+	select {
+	case p := <-paused:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("一時停止しなかった")
+	}
+
+	return Paused{}
+}
+
+const debuggerInput = `*start
+あ[p]
+[jump target="next"]
+*next
+い
+う[p]`
+
+func TestDebugger_ラベルの先頭で止まる(t *testing.T) {
+	q, d, paused := prepareDebugger(t, debuggerInput, Breakpoint{Label: "next"})
+	q.Start()
+	q.Wait()
+	q.Run()
+
+	p := receive(t, paused)
+	assert.Equal(t, PauseReasonBreakpoint, p.Reason)
+	assert.Equal(t, "next", p.Label)
+	assert.Equal(t, 0, p.Index)
+	assert.Equal(t, 5, p.Pos.Line)
+	assert.Equal(t, "<MsgEmit い>", p.Event.String())
+	current, ok := d.Paused()
+	assert.True(t, ok)
+	assert.Equal(t, "next", current.Label)
+	assert.Equal(t, "", q.Display())
+
+	d.Resume()
+	q.Wait()
+	_, ok = d.Paused()
+	assert.False(t, ok)
+	assert.Equal(t, "いう", q.Display())
+}
+
+func TestDebugger_行で止まり1イベントずつ進める(t *testing.T) {
+	q, d, paused := prepareDebugger(t, debuggerInput, Breakpoint{Line: 2})
+	q.Start()
+
+	p := receive(t, paused)
+	assert.Equal(t, "<MsgEmit あ>", p.Event.String())
+	// 同じ行の2つ目のイベントでは止まらない
+	d.Step()
+	p = receive(t, paused)
+	assert.Equal(t, PauseReasonStep, p.Reason)
+	assert.Equal(t, "<Flush>", p.Event.String())
+	assert.Equal(t, "あ", q.Display())
+
+	d.Resume()
+	q.Wait()
+	assert.Equal(t, "あ", q.Display())
+}
+
+func TestDebugger_コマンドの前で止まる(t *testing.T) {
+	q, d, paused := prepareDebugger(t, debuggerInput, Breakpoint{Command: "jump"})
+	q.Start()
+	q.Wait()
+	q.Run()
+
+	p := receive(t, paused)
+	assert.Equal(t, "<Jump next>", p.Event.String())
+	assert.Equal(t, Breakpoint{Command: "jump"}, p.Breakpoint)
+	d.Resume()
+	q.Wait()
+	assert.Equal(t, "いう", q.Display())
+}
+
+func TestDebugger_監視している値が変わったら止まる(t *testing.T) {
+	display := Breakpoint{Watch: func(q *Queue) string { return q.Display() }}
+	q, d, paused := prepareDebugger(t, debuggerInput, display)
+	q.Start()
+
+	p := receive(t, paused)
+	assert.Equal(t, PauseReasonWatch, p.Reason)
+	assert.Equal(t, "", p.Old)
+	assert.Equal(t, "あ", p.New)
+	assert.Equal(t, "<Flush>", p.Event.String())
+	d.Resume()
+	q.Wait()
+	assert.Equal(t, 0, len(paused))
+}
+
+func TestDebugger_一時停止と再開ができる(t *testing.T) {
+	q, d, paused := prepareDebugger(t, debuggerInput)
+	d.OnPause = func(p Paused) {
+		paused <- p
+		// コールバックの中からも進められる
+		if p.Index == 0 {
+			d.Step()
+		}
+	}
+	d.Pause()
+	q.Start()
+
+	assert.Equal(t, PauseReasonPause, receive(t, paused).Reason)
+	p := receive(t, paused)
+	assert.Equal(t, PauseReasonStep, p.Reason)
+	assert.Equal(t, 1, p.Index)
+	d.Resume()
+	q.Wait()
+	assert.Equal(t, "あ", q.Display())
+}
+
+func TestDebugger_止まっている間に停止すると解除する(t *testing.T) {
+	q, d, paused := prepareDebugger(t, debuggerInput, Breakpoint{Label: "next"})
+	q.Start()
+	q.Wait()
+	q.Run()
+	receive(t, paused)
+
+	q.Stop()
+	assert.Eventually(t, func() bool {
+		_, ok := d.Paused()
+		return !ok
+	}, time.Second, time.Millisecond)
+	// 止まっていたイベントは実行しない
+	assert.Equal(t, "", q.Display())
+}
+
+func TestCommandName_イベントのコマンド名を返す(t *testing.T) {
+	assert.Equal(t, "p", CommandName(&Flush{}))
+	assert.Equal(t, "image", CommandName(&ChangeBg{}))
+	assert.Equal(t, "", CommandName(&MsgEmit{}))
+}
@@ -0,0 +1,180 @@
+package event
+
+import (
+	"strings"
+	"sync"
+)
+
+// 文字の装飾
+type Style struct {
+	// 文字色。空のときはデフォルトの色
+	Color string
+	// 文字サイズ。0のときはデフォルトのサイズ
+	Size float64
+	// 太字
+	Bold bool
+	// 斜体
+	Italic bool
+	// 傍点
+	Emphasis bool
+}
+
+// 同じ装飾とルビが続く文字列
+type Run struct {
+	Text  string
+	Style Style
+	// 文字列にふるルビ。空のときはルビなし
+	// ルビの途中で装飾が変わった場合は、行ごとに最初のRunにだけつける。行をまたいだときは、それぞれの行の部分につける
+	Ruby string
+}
+
+// 1行ぶんの表示内容
+type Line []Run
+
+// 表示中の1文字
+type cell struct {
+	r     rune
+	style Style
+	// 属しているルビの番号。0のときはルビなし
+	ruby int
+}
+
+// 表示中の文字列を、装飾つきで保持する
+// ワーカーが書き込み、クライアントが読み込むのでロックする
+type buffer struct {
+	mu    sync.RWMutex
+	cells []cell
+	// ルビの文字列。ルビの番号-1で引く
+	rubies []string
+}
+
+// 表示内容とルビの文字列を消去する
+// ルビの途中で消去されることもあるので、番号rubyのルビは残して新しい番号を返す。0のときは残さない
+func (b *buffer) reset(ruby int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cells = []cell{}
+	if ruby == 0 {
+		b.rubies = nil
+		return 0
+	}
+	b.rubies = []string{b.rubies[ruby-1]}
+
+	return 1
+}
+
+// 改行を追加する
+func (b *buffer) newline() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cells = append(b.cells, cell{r: '\n'})
+}
+
+// ルビを登録して番号を返す
+func (b *buffer) addRuby(text string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rubies = append(b.rubies, text)
+
+	return len(b.rubies)
+}
+
+// 直近の行の開始位置と、その行の文字を返す
+func (b *buffer) lastLine() (int, []cell) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	start := 0
+	for i := len(b.cells) - 1; i >= 0; i-- {
+		if b.cells[i].r == '\n' {
+			start = i + 1
+			break
+		}
+	}
+	line := make([]cell, len(b.cells)-start)
+	copy(line, b.cells[start:])
+
+	return start, line
+}
+
+// 指定位置以降を置き換える
+func (b *buffer) replace(start int, cells []cell) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cells = append(b.cells[:start:start], cells...)
+}
+
+func (b *buffer) String() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var out strings.Builder
+	for _, c := range b.cells {
+		out.WriteRune(c.r)
+	}
+
+	return out.String()
+}
+
+// 行ごとに、装飾とルビでまとめて返す
+func (b *buffer) lines() []Line {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := []Line{{}}
+	var text strings.Builder
+	var cur *cell
+	rubyDone := map[int]bool{}
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		run := Run{Text: text.String(), Style: cur.style}
+		if cur.ruby != 0 && !rubyDone[cur.ruby] {
+			run.Ruby = b.rubies[cur.ruby-1]
+			rubyDone[cur.ruby] = true
+		}
+		result[len(result)-1] = append(result[len(result)-1], run)
+		text.Reset()
+		cur = nil
+	}
+	for i := range b.cells {
+		c := b.cells[i]
+		if c.r == '\n' {
+			flush()
+			result = append(result, Line{})
+			// 行をまたいだルビは、次の行の部分にもつける
+			rubyDone = map[int]bool{}
+			continue
+		}
+		if cur != nil && (cur.style != c.style || cur.ruby != c.ruby) {
+			flush()
+		}
+		if cur == nil {
+			cur = &c
+		}
+		text.WriteRune(c.r)
+	}
+	flush()
+
+	return result
+}
+
+// 文字列に改行を挿入する
+func insertBreakCells(cells []cell, breaks []int) []cell {
+	result := make([]cell, 0, len(cells)+len(breaks))
+	j := 0
+	for i, c := range cells {
+		if j < len(breaks) && breaks[j] == i {
+			result = append(result, cell{r: '\n'})
+			j++
+		}
+		result = append(result, c)
+	}
+
+	return result
+}
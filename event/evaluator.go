@@ -1,22 +1,40 @@
 package event
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/kijimaD/nova/ast"
 	"github.com/kijimaD/nova/token"
+	"github.com/kijimaD/nova/utils"
 )
 
 // 評価器。ASTをイベント列に変換する
 // 最初にファイル全体のASTを入れてEvalすることで、ラベルASTをマスタにセットする
-// その後はマスタからラベル位置のASTをEvalすることで、任意のラベル位置のイベント列を得られる
+// ラベルの本体は、再生するときに初めてイベント列にコンパイルする。一度コンパイルしたものはキャッシュし、同じ評価器を使う複数のキューで共有する
 type Evaluator struct {
-	// 現在保持しているイベント
+	// 現在保持しているイベント。ラベル以外のノードをEvalしたときに追加する
 	Events []Event
 	// シナリオファイルのASTをラベルごとに格納したマスタ
 	LabelMaster LabelMaster
-	errors      []error
+
+	// LabelMaster、errors、compiledを保護する。キューのワーカーから並行して呼ばれるため
+	mu     sync.Mutex
+	errors []error
+	// ラベル名ごとのコンパイル済みイベント列
+	compiled map[string]*CompiledLabel
+}
+
+// ラベル本体をコンパイルしたイベント列
+// 生成後は変更しないので、複数のキューで共有できる
+type CompiledLabel struct {
+	Name   string
+	Events []Event
+	// イベントごとの、元になったソース上の位置。Eventsと同じ長さ
+	Positions []token.Position
 }
 
 func NewEvaluator() *Evaluator {
@@ -24,11 +42,25 @@ func NewEvaluator() *Evaluator {
 		Events:      []Event{},
 		LabelMaster: LabelMaster{Labels: []Label{}, LabelIndex: map[string]int{}},
 		errors:      []error{},
+		compiled:    map[string]*CompiledLabel{},
 	}
 
 	return &e
 }
 
+// コンパイル済みのイベント列から初期化する。ASTは持たない
+func NewEvaluatorFromCompiled(labels []*CompiledLabel) *Evaluator {
+	e := NewEvaluator()
+	for _, c := range labels {
+		e.LabelMaster.AddLabel(Label{Name: c.Name})
+		if _, ok := e.compiled[c.Name]; !ok {
+			e.compiled[c.Name] = c
+		}
+	}
+
+	return e
+}
+
 func (e *Evaluator) Eval(node ast.Node) Event {
 	switch node := node.(type) {
 	case *ast.Program:
@@ -39,64 +71,199 @@ func (e *Evaluator) Eval(node ast.Node) Event {
 		for _, statement := range node.Statements {
 			e.Eval(statement)
 		}
-	case *ast.CmdLiteral:
-		var eve Event
-		switch node.FuncName.Value {
-		case token.CMD_FLUSH:
-			eve = &Flush{}
-		case token.CMD_LINE_END_WAIT:
-			eve = &LineEndWait{}
-		case token.CMD_IMAGE:
-			eve = &ChangeBg{Source: node.Parameters.Map["source"]}
-		case token.CMD_WAIT:
-			duration, err := time.ParseDuration(fmt.Sprintf("%sms", node.Parameters.Map["time"]))
-			if err != nil {
-				e.errors = append(e.errors, err)
-				return nil
-			}
-			eve = &Wait{DurationMsec: duration}
-		case token.CMD_JUMP:
-			eve = &Jump{Target: node.Parameters.Map["target"]}
-		case token.CMD_NEWLINE:
-			eve = &Newline{}
+	case *ast.CmdLiteral, *ast.TextLiteral:
+		eve, err := newEvent(node)
+		if err != nil {
+			e.addError(err)
+			return nil
+		}
+		if eve == nil {
+			return nil
 		}
 		e.Events = append(e.Events, eve)
 		return eve
-	case *ast.TextLiteral:
-		m := &MsgEmit{Body: node.Value, DoneChan: make(chan bool, 1)}
-		e.Events = append(e.Events, m)
-		return m
 	case *ast.LabelLiteral:
+		// 本体はここではコンパイルせず、登録だけする
 		label := Label{
 			Name: node.LabelName.String(),
 			Body: node.Body,
 		}
+		e.mu.Lock()
 		e.LabelMaster.AddLabel(label)
-
-		return e.Eval(node.Body)
+		e.mu.Unlock()
 	case nil:
 	default:
-		e.errors = append(e.errors, fmt.Errorf("error: 未登録のASTを検知した %#v", node))
+		e.addError(fmt.Errorf("error: 未登録のASTを検知した %#v", node))
 		return nil
 	}
 
 	return nil
 }
 
-// 指定ラベルの内容でEventsを更新する
-func (e *Evaluator) play(key string) error {
+func (e *Evaluator) addError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.errors = append(e.errors, err)
+}
+
+// ノードをイベントに変換する。イベントにならないノードではnilを返す
+func newEvent(node ast.Node) (Event, error) {
+	switch node := node.(type) {
+	case *ast.CmdLiteral:
+		switch node.FuncName.Value {
+		case token.CMD_FLUSH:
+			return &Flush{}, nil
+		case token.CMD_LINE_END_WAIT:
+			return &LineEndWait{}, nil
+		case token.CMD_IMAGE:
+			return &ChangeBg{Source: node.Parameters.Get("source")}, nil
+		case token.CMD_WAIT:
+			duration, err := time.ParseDuration(fmt.Sprintf("%sms", node.Parameters.Get("time")))
+			if err != nil {
+				return nil, err
+			}
+			return &Wait{DurationMsec: duration}, nil
+		case token.CMD_DELAY:
+			speed := node.Parameters.Get("speed")
+			if speed == "nowait" {
+				return &Delay{NoWait: true}, nil
+			}
+			duration, err := time.ParseDuration(fmt.Sprintf("%sms", speed))
+			if err != nil {
+				return nil, err
+			}
+			return &Delay{Speed: duration}, nil
+		case token.CMD_FONT:
+			return newFont(node.Parameters)
+		case token.CMD_RESET_FONT:
+			return &ResetFont{}, nil
+		case token.CMD_RUBY:
+			return &Ruby{Text: node.Parameters.Get("text")}, nil
+		case token.CMD_END_RUBY:
+			return &EndRuby{}, nil
+		case token.CMD_JUMP:
+			return &Jump{Target: node.Parameters.Get("target")}, nil
+		case token.CMD_NEWLINE:
+			return &Newline{}, nil
+		case token.CMD_CHOICE:
+			return &Choice{Text: node.Parameters.Get("text"), Target: node.Parameters.Get("target")}, nil
+		case token.CMD_SELECT:
+			return &Select{}, nil
+		}
+	case *ast.TextLiteral:
+		return &MsgEmit{Body: node.Value}, nil
+	}
+
+	return nil, nil
+}
+
+// fontコマンドの引数から、指定された項目だけを持つイベントを生成する
+func newFont(params ast.NamedParams) (*Font, error) {
+	font := Font{}
+	if v, ok := params.Lookup("color"); ok {
+		font.Color = utils.GetPtr(v)
+	}
+	if v, ok := params.Lookup("size"); ok {
+		size, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, err
+		}
+		font.Size = utils.GetPtr(size)
+	}
+	for key, dst := range map[string]**bool{
+		"bold":     &font.Bold,
+		"italic":   &font.Italic,
+		"emphasis": &font.Emphasis,
+	} {
+		v, ok := params.Lookup(key)
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		*dst = utils.GetPtr(b)
+	}
+
+	return &font, nil
+}
+
+// ラベルをコンパイルしたイベント列を返す
+// 初回だけコンパイルし、以降はキャッシュを返す
+// 値を変換できないコマンドがあるときは、位置つきのエラーをまとめて返す。失敗したラベルはキャッシュしない
+func (e *Evaluator) Compile(key string) (*CompiledLabel, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if c, ok := e.compiled[key]; ok {
+		return c, nil
+	}
 	label, err := e.LabelMaster.GetLabel(key)
 	if err != nil {
-		return fmt.Errorf(`指定ラベルが存在しない "%s"`, key)
+		return nil, fmt.Errorf(`指定ラベルが存在しない "%s"`, key)
 	}
 
-	e.Events = []Event{} // 初期化
-	e.Eval(label.Body)
+	c := &CompiledLabel{Name: label.Name, Events: []Event{}, Positions: []token.Position{}}
+	errs := []error{}
+	for _, stmt := range label.Body.Statements {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		eve, err := newEvent(es.Expression)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: 不正な値: %w", es.Token.Pos, err))
+			continue
+		}
+		if eve == nil {
+			continue
+		}
+		c.Events = append(c.Events, eve)
+		c.Positions = append(c.Positions, es.Token.Pos)
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	e.compiled[key] = c
 
-	return nil
+	return c, nil
+}
+
+// ラベル以外のノードを評価したときに発生したエラーを返す
+// ラベル本体のエラーはCompileが返す
+func (e *Evaluator) Errors() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]error{}, e.errors...)
+}
+
+// すべてのラベルを定義順にコンパイルして返す
+// コンパイルできないラベルがあっても続け、すべてのエラーをまとめて返す
+func (e *Evaluator) CompileAll() ([]*CompiledLabel, error) {
+	result := []*CompiledLabel{}
+	errs := []error{}
+	for _, name := range e.Labels() {
+		c, err := e.Compile(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result = append(result, c)
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return result, nil
 }
 
 func (e *Evaluator) Labels() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	names := []string{}
 	for _, label := range e.LabelMaster.Labels {
 		names = append(names, label.Name)
@@ -1,10 +1,14 @@
 package event
 
 import (
+	"io"
+	"strings"
 	"testing"
 
+	"github.com/kijimaD/nova/internal/fixture"
 	"github.com/kijimaD/nova/lexer"
 	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/token"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -109,3 +113,160 @@ xxx
 		})
 	}
 }
+
+func TestEval_コメントはイベントにならない(t *testing.T) {
+	q := prepareQueue(t, `*start
+; コメント
+あ[l]
+/* ブロック
+コメント */
+い[p]`)
+	assert.NoError(t, q.Play("start"))
+	expect := []string{
+		"<MsgEmit あ>",
+		"<LineEndWait>",
+		"<MsgEmit い>",
+		"<Flush>",
+	}
+	assert.Equal(t, expect, q.DumpQueue())
+}
+
+func TestEval_クォートしない値を使える(t *testing.T) {
+	q := prepareQueue(t, `*start
+[wait time=100]
+[jump target=start]`)
+	assert.NoError(t, q.Play("start"))
+	expect := []string{
+		"<Wait 100ms>",
+		"<Jump start>",
+	}
+	assert.Equal(t, expect, q.DumpQueue())
+}
+
+func BenchmarkEval(b *testing.B) {
+	input := fixture.LargeScenario(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p := parser.NewParser(lexer.NewLexerFromReader(strings.NewReader(input)))
+		e := NewEvaluator()
+		for {
+			stmt, err := p.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			e.Eval(stmt)
+		}
+	}
+}
+
+func BenchmarkCompile(b *testing.B) {
+	input := fixture.LargeScenario(1000)
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		e := NewEvaluator()
+		e.Eval(program)
+		for _, label := range e.Labels() {
+			if _, err := e.Compile(label); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestCompile_再生するまでコンパイルしない(t *testing.T) {
+	q := prepareQueue(t, `*start
+スタート[p]
+*ch1
+[wait time=xxx]`)
+	assert.Equal(t, 0, len(q.Evaluator.compiled))
+	assert.Equal(t, 0, len(q.Evaluator.errors))
+
+	assert.NoError(t, q.Play("start"))
+	assert.Equal(t, 1, len(q.Evaluator.compiled))
+	assert.Equal(t, 0, len(q.Evaluator.errors))
+}
+
+func TestCompile_コンパイル結果をキャッシュする(t *testing.T) {
+	e := NewEvaluator()
+	l := lexer.NewLexer(`*start
+スタート[p]
+  [jump target=start]`)
+	program, err := parser.NewParser(l).ParseProgram()
+	assert.NoError(t, err)
+	e.Eval(program)
+
+	c1, err := e.Compile("start")
+	assert.NoError(t, err)
+	c2, err := e.Compile("start")
+	assert.NoError(t, err)
+	assert.Same(t, c1, c2)
+
+	assert.Equal(t, "start", c1.Name)
+	assert.Equal(t, 3, len(c1.Events))
+	assert.Equal(t, []token.Position{
+		{Offset: 7, Line: 2, Column: 1},
+		{Offset: 19, Line: 2, Column: 5},
+		{Offset: 25, Line: 3, Column: 3},
+	}, c1.Positions)
+
+	_, err = e.Compile("not exists")
+	assert.Error(t, err)
+}
+
+func TestCompile_不正な値はエラーを返してキャッシュしない(t *testing.T) {
+	e := NewEvaluator()
+	l := lexer.NewLexer(`*start
+あ[wait time=xxx]
+[font size=big]い[p]`)
+	program, err := parser.NewParser(l).ParseProgram()
+	assert.NoError(t, err)
+	e.Eval(program)
+
+	_, err = e.Compile("start")
+	assert.EqualError(t, err, `2:2: 不正な値: time: invalid duration "xxxms"
+3:1: 不正な値: strconv.ParseFloat: parsing "big": invalid syntax`)
+	assert.Equal(t, 0, len(e.compiled))
+	_, err = e.Compile("start")
+	assert.Error(t, err)
+
+	_, err = e.CompileAll()
+	assert.Error(t, err)
+
+	q := NewQueue(e)
+	assert.Error(t, q.Play("start"))
+}
+
+func TestCompile_複数のキューで共有できる(t *testing.T) {
+	q1 := prepareQueue(t, `*start
+あいうえお[p]
+かきくけこ[p]`)
+	q2 := NewQueue(q1.Evaluator)
+	q1.Start()
+	q2.Start()
+
+	q1.Skip()
+	q1.Wait()
+	assert.Equal(t, "あいうえお", q1.Display())
+	q1.Run()
+	q1.Skip()
+	q1.Wait()
+	assert.Equal(t, "かきくけこ", q1.Display())
+
+	// 別のキューの進行には影響しない
+	q2.Skip()
+	q2.Wait()
+	assert.Equal(t, "あいうえお", q2.Display())
+}
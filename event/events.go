@@ -2,6 +2,7 @@ package event
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/kijimaD/nova/logger"
@@ -18,7 +19,7 @@ type Event interface {
 
 // アニメーション状態を持ち、スキップ可能なイベント
 type Skipper interface {
-	Skip()
+	Skip(*Queue)
 }
 
 // クリック待ちにするイベント
@@ -26,24 +27,22 @@ type Blocker interface {
 	IsBlock()
 }
 
-// ================
+// クライアント側での実装が必要で、NotifyChanに送るイベント
+type Notifier interface {
+	IsNotify()
+}
 
-var (
-	messageSpeed = 20 * time.Millisecond
-)
+// ================
 
 // メッセージ表示
 type MsgEmit struct {
 	// パーサーから渡ってきた表示対象の文字列
 	Body string
-	// 終了判定チャンネル。closeしてれば終了
-	DoneChan chan bool
 }
 
 func NewMsgEmit(body string) MsgEmit {
 	return MsgEmit{
-		Body:     body,
-		DoneChan: make(chan bool, 1),
+		Body: body,
 	}
 }
 
@@ -54,20 +53,45 @@ func (e *MsgEmit) String() string {
 // 実行中タスクに合わせてPop()もしくはSkip()する
 // 文字送り中か文字表示完了かの2通りの状態がある
 func (e *MsgEmit) Before(q *Queue) {
-	lineLen := 24
+	config := q.messageConfig()
+	done := q.done()
+
+	// 直近の行は本文とあわせて折り返し位置を決める。句読点や単語が行をまたぐかは、先まで見ないとわからないため
+	start, head := q.buf.lastLine()
+	cells := head
+	for _, r := range e.Body {
+		cells = append(cells, cell{r: r, style: q.style, ruby: q.ruby})
+	}
+	runes := make([]rune, len(cells))
+	groups := make([]int, len(cells))
+	for i, c := range cells {
+		runes[i] = c.r
+		groups[i] = c.ruby
+	}
+	breaks := newLineBreaker(config).breaks(runes, groups)
+
+	if config.Instant {
+		q.buf.replace(start, insertBreakCells(cells, breaks))
+		q.finish(done)
+		q.OnAnim.Store(true)
 
-	for i, char := range e.Body {
+		q.popChan <- struct{}{}
+		logger.MyLog.Debug("popChan通知@即時表示")
+
+		return
+	}
+
+	for i := len(head); i < len(cells); i++ {
 		select {
-		case _, ok := <-e.DoneChan:
+		case _, ok := <-done:
 			// フラグが立ったら残りの文字を一気に表示
 			if !ok {
 				continue
 			}
-			q.buf += e.Body[i:]
-			q.buf = autoNewline(q.buf, lineLen)
+			q.buf.replace(start, insertBreakCells(cells, breaks))
 
-			close(e.DoneChan)
-			q.OnAnim = true
+			q.finish(done)
+			q.OnAnim.Store(true)
 
 			q.popChan <- struct{}{}
 			logger.MyLog.Debug("popChan通知@スキップ")
@@ -75,15 +99,14 @@ func (e *MsgEmit) Before(q *Queue) {
 			return
 		default:
 			// フラグが立ってないので1文字ずつ表示
-			q.buf += string(char)
-			q.buf = autoNewline(q.buf, lineLen)
-			time.Sleep(messageSpeed)
+			q.buf.replace(start, insertBreakCells(cells[:i+1], breaks))
+			time.Sleep(q.messageConfig().MessageSpeed)
 		}
 	}
 
 	// 1文字ずつ表示し終わった場合
-	close(e.DoneChan)
-	q.OnAnim = true
+	q.finish(done)
+	q.OnAnim.Store(true)
 
 	q.popChan <- struct{}{}
 	logger.MyLog.Debug("popChan通知@順当")
@@ -93,7 +116,7 @@ func (e *MsgEmit) Before(q *Queue) {
 
 func (e *MsgEmit) After(q *Queue) {
 	select {
-	case _, ok := <-e.DoneChan:
+	case _, ok := <-q.done():
 		// close
 		if !ok {
 			q.popChan <- struct{}{}
@@ -101,12 +124,12 @@ func (e *MsgEmit) After(q *Queue) {
 		}
 	default:
 		// チャネルがクローズされているわけでもなく、値もまだ来ていない
-		e.Skip()
+		e.Skip(q)
 	}
 }
 
-func (e *MsgEmit) Skip() {
-	e.DoneChan <- true
+func (e *MsgEmit) Skip(q *Queue) {
+	q.requestSkip()
 }
 
 // ================
@@ -121,11 +144,12 @@ func (c *Flush) String() string {
 func (c *Flush) Before(q *Queue) {}
 
 func (c *Flush) After(q *Queue) {
-	q.buf = ""
+	q.ruby = q.buf.reset(q.ruby)
 
+	// 次のPopで終了したときにDoneするので、先にAddしておく
+	q.wg.Add(1)
 	q.popChan <- struct{}{}
 	logger.MyLog.Debug("popChan通知@Flush")
-	q.wg.Add(1)
 }
 
 func (c *Flush) IsBlock() {}
@@ -142,11 +166,11 @@ func (l *LineEndWait) String() string {
 func (l *LineEndWait) Before(q *Queue) {}
 
 func (l *LineEndWait) After(q *Queue) {
-	q.buf += "\n"
+	q.buf.newline()
 
+	q.wg.Add(1)
 	q.popChan <- struct{}{}
 	logger.MyLog.Debug("popChan通知@LineEndWait")
-	q.wg.Add(1)
 }
 
 func (l *LineEndWait) IsBlock() {}
@@ -170,6 +194,8 @@ func (c *ChangeBg) Before(q *Queue) {
 
 func (c *ChangeBg) After(q *Queue) {}
 
+func (c *ChangeBg) IsNotify() {}
+
 // ================
 
 // 秒数待ち
@@ -182,6 +208,9 @@ func (w *Wait) String() string {
 }
 
 func (w *Wait) Before(q *Queue) {
+	if q.Config().SkipWait {
+		return
+	}
 	time.Sleep(w.DurationMsec)
 
 	return
@@ -191,6 +220,140 @@ func (w *Wait) After(q *Queue) {}
 
 // ================
 
+// 文字表示速度の変更
+type Delay struct {
+	// 1文字表示するごとに待つ時間
+	Speed time.Duration
+	// trueのときは一気に表示する
+	NoWait bool
+}
+
+func (d *Delay) String() string {
+	if d.NoWait {
+		return "<Delay nowait>"
+	}
+
+	return fmt.Sprintf("<Delay %s>", d.Speed)
+}
+
+// 設定画面で変えたConfigは書き換えず、キューに覚えておく。文字を表示するときに合わせる
+func (d *Delay) Before(q *Queue) {
+	q.delay = d
+
+	return
+}
+
+func (d *Delay) After(q *Queue) {}
+
+// ================
+
+// 文字の装飾を変更する。指定した項目だけを変更する
+type Font struct {
+	Color    *string
+	Size     *float64
+	Bold     *bool
+	Italic   *bool
+	Emphasis *bool
+}
+
+func (f *Font) String() string {
+	attrs := []string{}
+	if f.Color != nil {
+		attrs = append(attrs, fmt.Sprintf("color=%s", *f.Color))
+	}
+	if f.Size != nil {
+		attrs = append(attrs, fmt.Sprintf("size=%g", *f.Size))
+	}
+	if f.Bold != nil {
+		attrs = append(attrs, fmt.Sprintf("bold=%t", *f.Bold))
+	}
+	if f.Italic != nil {
+		attrs = append(attrs, fmt.Sprintf("italic=%t", *f.Italic))
+	}
+	if f.Emphasis != nil {
+		attrs = append(attrs, fmt.Sprintf("emphasis=%t", *f.Emphasis))
+	}
+
+	return fmt.Sprintf("<Font %s>", strings.Join(attrs, " "))
+}
+
+func (f *Font) Before(q *Queue) {
+	if f.Color != nil {
+		q.style.Color = *f.Color
+	}
+	if f.Size != nil {
+		q.style.Size = *f.Size
+	}
+	if f.Bold != nil {
+		q.style.Bold = *f.Bold
+	}
+	if f.Italic != nil {
+		q.style.Italic = *f.Italic
+	}
+	if f.Emphasis != nil {
+		q.style.Emphasis = *f.Emphasis
+	}
+
+	return
+}
+
+func (f *Font) After(q *Queue) {}
+
+// ================
+
+// 文字の装飾を元に戻す
+type ResetFont struct{}
+
+func (r *ResetFont) String() string {
+	return "<ResetFont>"
+}
+
+func (r *ResetFont) Before(q *Queue) {
+	q.style = Style{}
+
+	return
+}
+
+func (r *ResetFont) After(q *Queue) {}
+
+// ================
+
+// ルビの開始。EndRubyまでの文字にルビをふる
+type Ruby struct {
+	Text string
+}
+
+func (r *Ruby) String() string {
+	return fmt.Sprintf("<Ruby %s>", r.Text)
+}
+
+func (r *Ruby) Before(q *Queue) {
+	q.ruby = q.buf.addRuby(r.Text)
+
+	return
+}
+
+func (r *Ruby) After(q *Queue) {}
+
+// ================
+
+// ルビの終了
+type EndRuby struct{}
+
+func (r *EndRuby) String() string {
+	return "<EndRuby>"
+}
+
+func (r *EndRuby) Before(q *Queue) {
+	q.ruby = 0
+
+	return
+}
+
+func (r *EndRuby) After(q *Queue) {}
+
+// ================
+
 // ジャンプ。別のラベルへ遷移する
 type Jump struct {
 	Target string
@@ -221,7 +384,7 @@ func (n *Newline) String() string {
 }
 
 func (n *Newline) Before(q *Queue) {
-	q.buf += "\n"
+	q.buf.newline()
 
 	return
 }
@@ -230,6 +393,45 @@ func (n *Newline) After(q *Queue) {}
 
 // ================
 
+// 選択肢を追加する。Selectで選択待ちになるまでためておく
+type Choice struct {
+	// 表示する文言
+	Text string
+	// 選んだときに遷移するラベル
+	Target string
+}
+
+func (c *Choice) String() string {
+	return fmt.Sprintf("<Choice %s %s>", c.Text, c.Target)
+}
+
+func (c *Choice) Before(q *Queue) {
+	q.choicesMu.Lock()
+	defer q.choicesMu.Unlock()
+
+	q.choices = append(q.choices, *c)
+}
+
+func (c *Choice) After(q *Queue) {}
+
+// ================
+
+// 選択待ちにする。ためておいた選択肢からQueue.Choose()で選ぶと、遷移先のラベルへ進む
+type Select struct{}
+
+func (s *Select) String() string {
+	return "<Select>"
+}
+
+func (s *Select) Before(q *Queue) {}
+
+// クリックでは進まない
+func (s *Select) After(q *Queue) {}
+
+func (s *Select) IsBlock() {}
+
+// ================
+
 // 未実装
 type NotImplement struct{}
 
@@ -96,3 +96,201 @@ func TestNewline_改行できる(t *testing.T) {
 	q.Wait()
 	assert.Equal(t, "\nえええ\nおおお\n", q.Display())
 }
+
+func TestDelay_文字表示速度を変更できる(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="30"]
+あいう[l]
+[delay speed="nowait"]
+えお[l]`)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "あいう", q.Display())
+	assert.Equal(t, 30*time.Millisecond, q.messageConfig().MessageSpeed)
+	assert.False(t, q.messageConfig().Instant)
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "あいう\nえお", q.Display())
+	assert.True(t, q.messageConfig().Instant)
+}
+
+func TestDelay_設定を書き換えない(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="30"]
+あいう[l]
+えお[l]`)
+	config := q.Config()
+	config.MessageSpeed = 5 * time.Millisecond
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, 5*time.Millisecond, q.Config().MessageSpeed)
+	assert.Equal(t, 30*time.Millisecond, q.messageConfig().MessageSpeed)
+
+	// 設定で一気に表示するようにすると、[delay]より優先する
+	config = q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	assert.True(t, q.messageConfig().Instant)
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "あいう\nえお", q.Display())
+}
+
+func TestFont_文字を装飾できる(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="nowait"]
+[font color="#ff0000" bold="true"]赤[font size="30"]大[resetfont]普通[l]
+[font emphasis="true" italic="true"]傍点[p]`)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "赤大普通", q.Display())
+	assert.Equal(t, []Line{
+		{
+			{Text: "赤", Style: Style{Color: "#ff0000", Bold: true}},
+			{Text: "大", Style: Style{Color: "#ff0000", Bold: true, Size: 30}},
+			{Text: "普通"},
+		},
+	}, q.Lines())
+	q.Run()
+	q.Wait()
+	assert.Equal(t, []Line{
+		{
+			{Text: "赤", Style: Style{Color: "#ff0000", Bold: true}},
+			{Text: "大", Style: Style{Color: "#ff0000", Bold: true, Size: 30}},
+			{Text: "普通"},
+		},
+		{
+			{Text: "傍点", Style: Style{Italic: true, Emphasis: true}},
+		},
+	}, q.Lines())
+}
+
+func TestRuby_ルビをふれる(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="nowait"]
+今日は[ruby text="かんじ"]漢字[endruby]です[p]`)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "今日は漢字です", q.Display())
+	assert.Equal(t, []Line{
+		{
+			{Text: "今日は"},
+			{Text: "漢字", Ruby: "かんじ"},
+			{Text: "です"},
+		},
+	}, q.Lines())
+}
+
+func TestRuby_ルビをふった文字列の途中では折り返さない(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="nowait"]
+あいう[ruby text="かんじ"]漢字[endruby][p]`)
+	config := q.Config()
+	config.LineLen = 4
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "あいう\n漢字", q.Display())
+	assert.Equal(t, []Line{
+		{{Text: "あいう"}},
+		{{Text: "漢字", Ruby: "かんじ"}},
+	}, q.Lines())
+}
+
+func TestRuby_行をまたいだルビはそれぞれの行につける(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="nowait"]
+[ruby text="ちょうじゅげむ"]長寿限無[endruby][p]`)
+	config := q.Config()
+	config.LineLen = 2
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "長寿\n限無", q.Display())
+	assert.Equal(t, []Line{
+		{{Text: "長寿", Ruby: "ちょうじゅげむ"}},
+		{{Text: "限無", Ruby: "ちょうじゅげむ"}},
+	}, q.Lines())
+}
+
+func TestRuby_1文字ずつ表示する(t *testing.T) {
+	// 文字送りの途中の状態を、バッファに直接書き込んで作る
+	b := buffer{}
+	ruby := b.addRuby("かんじ")
+	b.replace(0, []cell{{r: '漢', ruby: ruby}})
+	assert.Equal(t, []Line{{{Text: "漢", Ruby: "かんじ"}}}, b.lines())
+	b.replace(0, []cell{{r: '漢', ruby: ruby}, {r: '字', ruby: ruby}})
+	assert.Equal(t, []Line{{{Text: "漢字", Ruby: "かんじ"}}}, b.lines())
+}
+
+func TestRuby_改ページでルビの文字列を消す(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="nowait"]
+[ruby text="かんじ"]漢字[endruby][p]
+[ruby text="ふりがな"]振仮名[endruby][ruby text="とちゅう"]途[p]
+中[endruby][p]`)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, []string{"かんじ"}, q.buf.rubies)
+	q.Run()
+	q.Wait()
+	assert.Equal(t, []string{"ふりがな", "とちゅう"}, q.buf.rubies)
+	// ルビの途中で改ページしたときは、続きのルビだけ残す
+	q.Run()
+	q.Wait()
+	assert.Equal(t, []string{"とちゅう"}, q.buf.rubies)
+	assert.Equal(t, []Line{{{Text: "中", Ruby: "とちゅう"}}}, q.Lines())
+}
+
+func TestSelect_選んだ選択肢のラベルへ進む(t *testing.T) {
+	q := prepareQueue(t, `*start
+どうする？[l]
+[choice text="右へ" target="right"]
+[choice text="左へ" target="left"]
+[select]
+*right
+右へ進んだ[p]
+*left
+左へ進んだ[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "どうする？", q.Display())
+	assert.Error(t, q.Choose(0))
+	q.Run()
+	q.Wait()
+	assert.IsType(t, &Select{}, q.Head())
+	assert.Equal(t, []Choice{{Text: "右へ", Target: "right"}, {Text: "左へ", Target: "left"}}, q.Choices())
+
+	assert.Error(t, q.Choose(2))
+	assert.NoError(t, q.Choose(1))
+	q.Wait()
+	assert.Equal(t, "left", q.CurrentLabel)
+	assert.Equal(t, "どうする？\n左へ進んだ", q.Display())
+	assert.Equal(t, 0, len(q.Choices()))
+}
+
+func TestWait_設定で待たずに進められる(t *testing.T) {
+	q := prepareQueue(t, `*start
+[wait time=10000]
+あ[p]`)
+	config := q.Config()
+	config.Instant = true
+	config.SkipWait = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, "あ", q.Display())
+}
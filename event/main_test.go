@@ -8,7 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func prepareQueue(t *testing.T, input string) Queue {
+func prepareQueue(t *testing.T, input string) *Queue {
 	t.Helper()
 
 	l := lexer.NewLexer(input)
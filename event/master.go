@@ -31,5 +31,6 @@ func (m *LabelMaster) AddLabel(label Label) {
 
 type Label struct {
 	Name string
+	// コンパイル済みのイベント列から読み込んだときはnil
 	Body *ast.BlockStatement
 }
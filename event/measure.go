@@ -0,0 +1,23 @@
+package event
+
+// 文字列の描画幅を測る。フォントに合わせた折り返し位置の計算に使う
+type Measurer interface {
+	// 文字列の送り幅を返す
+	Advance(s string) float64
+}
+
+// 等幅フォントを想定した実装。半角文字は全角文字の半分の幅とする
+// テストやウィンドウのない環境で使う
+type FixedWidthMeasurer struct {
+	// 全角1文字の幅
+	Size float64
+}
+
+func (m FixedWidthMeasurer) Advance(s string) float64 {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+
+	return float64(w) * m.Size / 2
+}
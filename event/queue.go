@@ -1,16 +1,24 @@
 package event
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kijimaD/nova/logger"
+	"github.com/kijimaD/nova/token"
 )
 
+// クリック待ちでないので、差し替えられない
+var ErrBusy = errors.New("クリック待ちではない")
+
 // queueて名前、おかしいかもしれない
 // 文字列は構造体にしたい
 type Queue struct {
-	// 評価器
+	// 評価器。Start()の後はReload()で差し替える
 	Evaluator *Evaluator
 	// 内部で利用するイベントキュー
 	// すべてのイベントが入る可能性がある
@@ -23,30 +31,83 @@ type Queue struct {
 	// 現在表示中の文字列
 	// 利用側はこの文字列を表示するだけで、いい感じに表示できる
 	// アニメーション用に1文字ずつ増えていく
-	buf string
+	buf buffer
+	// 現在の文字の装飾。以降に表示する文字に適用する
+	style Style
+	// 現在のルビの番号。0のときはルビなし
+	ruby int
+	// 実行中の状態を守るロック。cur、doneChan、curLabel、curIndex、Evaluator、CurrentLabel、program、WaitingQueueはロックを取って読み書きする
+	// Pop、ワーカー、クライアントの操作がそれぞれ別のゴルーチンから触る
+	mu sync.Mutex
+	// Run、Choose、Reload、Gotoを1つずつ行うためのロック。ワーカーは取らない
+	opMu sync.Mutex
 	// 実行中イベント
 	cur Event
+	// 実行中のスキップ可能イベントの終了判定チャンネル。closeしてれば終了
+	// イベントは複数のキューで共有するので、実行ごとの状態はキューに持つ
+	doneChan chan bool
+	// doneChanをcloseしたか。closeしたチャンネルには送れないので、スキップするときに確認する
+	doneClosed bool
 	// WaitGroup。クリック待ちイベントに到達するまでで1つの単位としている。そのため複数グループをまたぐ可能性がある
 	// テストでWait()して確認しやすくする
-	wg sync.WaitGroup
+	wg waitGroup
 	// アニメーション待ち状態かどうか
-	OnAnim bool
+	OnAnim atomic.Bool
+	// メッセージ表示の設定
+	config   Config
+	configMu sync.RWMutex
+	// シナリオの[delay]で指定した文字表示速度。nilのときは設定のまま。ワーカーだけが読み書きする
+	delay *Delay
+	// Run()した回数。自動送りの待機中にクリックされたかを判定するのに使う
+	runCount atomic.Int64
+	// 最後のイベントまで実行したかどうか
+	ended atomic.Bool
+	// closeするとワーカーを止める
+	stopChan chan struct{}
+	stopOnce sync.Once
+	// 選択待ちになるまでにためた選択肢
+	choices   []Choice
+	choicesMu sync.Mutex
+	// 実行中イベントのラベルと、ラベル内での番号
+	curLabel string
+	curIndex int
+
+	// 実行を観察するためのフック
+	Hooks Hooks
+	// 指定すると、再生したラベルと実行したイベントを記録する。Start()の前に設定する
+	Coverage *Coverage
+	// 指定すると、イベントを実行する前にブレークポイントを確認し、一時停止できる。Start()の前に設定する
+	Debugger *Debugger
 
 	// 現在実行中のラベル。クライアントが再生中のラベルを表示するのに使う
 	CurrentLabel string
+	// 現在実行中のラベルのコンパイル済みイベント列
+	program *CompiledLabel
 	// 実行待ちのイベントキュー。ここにある時点ではまだ実行されているわけではない。先頭から実行し、実行済みの要素は削除される
+	// programのイベント列を共有しているので、要素を書き換えてはいけない
 	WaitingQueue []Event
 }
 
-func NewQueue(evaluator *Evaluator) Queue {
+// キューの実行を観察するためのフック。Start()の前に設定する
+// ワーカーのゴルーチンから呼ぶので、時間のかかる処理はしない
+type Hooks struct {
+	// ラベルを再生するときに呼ぶ
+	OnPlay func(label string)
+	// イベントを実行する直前に呼ぶ
+	OnEvent func(e Event)
+}
+
+func NewQueue(evaluator *Evaluator) *Queue {
 	q := Queue{
 		Evaluator:  evaluator,
 		workerChan: make(chan Event, 1024),
 		NotifyChan: make(chan Event, 1024),
 		popChan:    make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+		config:     DefaultConfig(),
 	}
 
-	return q
+	return &q
 }
 
 // 処理待受を開始する
@@ -60,7 +121,18 @@ func (q *Queue) Start() {
 	go func() {
 		for {
 			select {
+			case <-q.stopChan:
+				return
 			case event := <-q.workerChan:
+				if q.stopped() {
+					return
+				}
+				if q.Hooks.OnEvent != nil {
+					q.Hooks.OnEvent(event)
+				}
+				if q.Debugger != nil && !q.Debugger.check(q, event) {
+					return
+				}
 				event.Before(q)
 
 				_, isSkip := event.(Skipper)
@@ -70,6 +142,7 @@ func (q *Queue) Start() {
 					_, isBlock := event.(Blocker)
 					if isBlock {
 						q.wg.Done()
+						q.autoAdvance()
 					} else {
 						q.popChan <- struct{}{}
 						logger.MyLog.Debug("popChan通知@notIsWait")
@@ -80,8 +153,13 @@ func (q *Queue) Start() {
 	}()
 
 	go func() {
-		for range q.popChan {
-			q.Pop()
+		for {
+			select {
+			case <-q.stopChan:
+				return
+			case <-q.popChan:
+				q.Pop()
+			}
 		}
 	}()
 
@@ -91,36 +169,122 @@ func (q *Queue) Start() {
 	logger.MyLog.Debug("popChan通知@初回")
 }
 
+// 自動送りが有効なとき、一定時間後にクリック待ちを進める
+// 時間経過までにクリックされていた場合は何もしない
+func (q *Queue) autoAdvance() {
+	d := q.Config().AutoAdvance
+	if d <= 0 {
+		return
+	}
+	count := q.runCount.Load()
+	time.AfterFunc(d, func() {
+		if count == q.runCount.Load() {
+			q.Run()
+		}
+	})
+}
+
 func (q *Queue) Play(label string) error {
-	q.CurrentLabel = label
-	err := q.Evaluator.play(label)
+	q.mu.Lock()
+	err := q.load(label)
+	q.mu.Unlock()
 	if err != nil {
 		return err
 	}
+	q.played(label)
 
-	newQueue := make([]Event, len(q.Evaluator.Events))
-	copy(newQueue, q.Evaluator.Events)
-	q.WaitingQueue = newQueue
+	return nil
+}
+
+// ラベルをコンパイルして、先頭から実行するようにイベント列を差し替える。ロックを取ってから呼ぶ
+func (q *Queue) load(label string) error {
+	program, err := q.Evaluator.Compile(label)
+	if err != nil {
+		return err
+	}
+	q.CurrentLabel = label
+	q.program = program
+	q.WaitingQueue = program.Events
+	q.ended.Store(false)
 
 	return nil
 }
 
+// ラベルを再生したことを記録し、フックを呼ぶ。フックからキューを操作できるように、ロックを取らずに呼ぶ
+func (q *Queue) played(label string) {
+	if q.Coverage != nil {
+		q.Coverage.play(label)
+	}
+	if q.Hooks.OnPlay != nil {
+		q.Hooks.OnPlay(label)
+	}
+}
+
 // 処理中インデックスを進める
-// イベント列の先頭をチャンネルに入れて、現在処理中とする。そして処理したイベント列の先頭を切る
-// 名前から想像する挙動は、切り出してからイベントに入れる、であるが...
+// イベント列の先頭を切り出して、現在処理中としてチャンネルに入れる
 func (q *Queue) Pop() {
+	q.mu.Lock()
 	if len(q.WaitingQueue) == 0 {
+		q.mu.Unlock()
+		// 続きがないので終了する。クリック待ちと同じく待機を解除する
+		if q.ended.CompareAndSwap(false, true) {
+			q.wg.Done()
+		}
 		return
 	}
+	q.curLabel = q.CurrentLabel
+	q.curIndex = len(q.program.Events) - len(q.WaitingQueue)
 	q.cur = q.WaitingQueue[0]
-	q.workerChan <- q.cur
+	// ワーカーに渡すとジャンプでイベント列を差し替えることがあるので、渡す前に切る
 	q.WaitingQueue = q.WaitingQueue[1:]
+	if _, ok := q.cur.(Skipper); ok {
+		q.doneChan = make(chan bool, 1)
+		q.doneClosed = false
+	}
+	label, index, cur := q.curLabel, q.curIndex, q.cur
+	q.mu.Unlock()
+
+	if q.Coverage != nil {
+		q.Coverage.hit(label, index)
+	}
+	q.workerChan <- cur
+}
+
+// 実行中のスキップ可能なイベントの終了判定チャンネルを返す
+func (q *Queue) done() chan bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.doneChan
+}
+
+// 実行中のスキップ可能なイベントに、スキップするように伝える。終わっているときや、伝えてあるときは何もしない
+func (q *Queue) requestSkip() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.doneClosed {
+		return
+	}
+	select {
+	case q.doneChan <- true:
+	default:
+	}
+}
+
+// 実行中のスキップ可能なイベントが終わったことを、終了判定チャンネルをcloseして伝える
+func (q *Queue) finish(done chan bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.doneClosed = true
+	close(done)
 }
 
 // 現在処理中の、スキップ可能なタスクをスキップする
 func (q *Queue) Skip() {
-	if e, ok := q.cur.(Skipper); ok {
-		e.Skip()
+	if e, ok := q.Head().(Skipper); ok {
+		e.Skip(q)
 	}
 }
 
@@ -128,26 +292,320 @@ func (q *Queue) Skip() {
 // 実行中タスクに合わせてPop()もしくはSkip()する
 // 非ブロックのイベントでは、自動でPopするのでこの関数を通過しない
 func (q *Queue) Run() {
-	q.OnAnim = false
-	q.cur.After(q)
+	q.opMu.Lock()
+	defer q.opMu.Unlock()
+
+	if q.Ended() {
+		return
+	}
+	q.runCount.Add(1)
+	q.OnAnim.Store(false)
+	q.Head().After(q)
 }
 
 // すべてのジョブが処理されるまで待機
+// Stop()したときも待機を解除する
 func (q *Queue) Wait() {
 	q.wg.Wait()
 }
 
 // 処理中タスクを取得する
 func (q *Queue) Head() Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	return q.cur
 }
 
+// 処理中タスクのラベル名と、ラベル内での番号を返す
+func (q *Queue) Location() (string, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.curLabel, q.curIndex
+}
+
+// ある時点での処理中タスクの状態
+type Snapshot struct {
+	Label string
+	Index int
+	Pos   token.Position
+	Event Event
+	// ラベル内で、処理中タスクより後ろにあるイベント
+	Rest []Event
+}
+
+// 処理中タスクの状態をまとめて返す。別のゴルーチンから調べるときに、ずれのない値を得るのに使う
+func (q *Queue) Snapshot() Snapshot {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := Snapshot{Label: q.curLabel, Index: q.curIndex, Pos: q.position(), Event: q.cur, Rest: []Event{}}
+	if q.program != nil && q.curIndex+1 < len(q.program.Events) {
+		s.Rest = append(s.Rest, q.program.Events[q.curIndex+1:]...)
+	}
+
+	return s
+}
+
+// 処理中タスクのソース上の位置を返す。わからないときはゼロ値を返す
+func (q *Queue) Position() token.Position {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.position()
+}
+
+// ロックを取ってから呼ぶ
+func (q *Queue) position() token.Position {
+	if q.program == nil || q.curIndex >= len(q.program.Positions) {
+		return token.Position{}
+	}
+
+	return q.program.Positions[q.curIndex]
+}
+
+// 最後のイベントまで実行したか
+func (q *Queue) Ended() bool {
+	return q.ended.Load()
+}
+
+// ワーカーを止める。以降はイベントを実行しない
+// Wait()で待っているゴルーチンも解除する
+func (q *Queue) Stop() {
+	q.stopOnce.Do(func() {
+		close(q.stopChan)
+		q.wg.stop()
+	})
+}
+
+func (q *Queue) stopped() bool {
+	select {
+	case <-q.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// 選択待ちで表示する選択肢を返す
+func (q *Queue) Choices() []Choice {
+	q.choicesMu.Lock()
+	defer q.choicesMu.Unlock()
+
+	return append([]Choice{}, q.choices...)
+}
+
+// 選択待ちのときに、選択肢を選んで遷移先のラベルへ進む
+func (q *Queue) Choose(i int) error {
+	q.opMu.Lock()
+	defer q.opMu.Unlock()
+
+	target, err := q.choose(i)
+	if err != nil {
+		return err
+	}
+	q.played(target)
+	q.choicesMu.Lock()
+	q.choices = nil
+	q.choicesMu.Unlock()
+
+	q.runCount.Add(1)
+	q.wg.Add(1)
+	q.popChan <- struct{}{}
+	logger.MyLog.Debug("popChan通知@Choose")
+
+	return nil
+}
+
+// 選択待ちか確かめて、選んだ選択肢の遷移先のラベルを読み込む
+func (q *Queue) choose(i int) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.cur.(*Select); !ok {
+		return "", errors.New("選択待ちではない")
+	}
+	choices := q.Choices()
+	if i < 0 || i >= len(choices) {
+		return "", fmt.Errorf("選択肢の範囲外: %d", i)
+	}
+	target := choices[i].Target
+
+	return target, q.load(target)
+}
+
+// 評価器を差し替えて、同じラベルの近い位置から実行し直す
+// 開発中にシナリオを書き換えたときに使う。クリック待ちか選択待ちか、最後まで実行したときだけ差し替えられる
+// 現在のイベントのソース上の位置に一番近いイベントを探し、そのページの先頭から表示し直す
+// ラベルが存在しなくなったときは、差し替えずにエラーを返す
+func (q *Queue) Reload(e *Evaluator) error {
+	q.opMu.Lock()
+	defer q.opMu.Unlock()
+
+	if err := q.reload(e); err != nil {
+		return err
+	}
+	q.restart()
+	logger.MyLog.Debug("popChan通知@Reload")
+
+	return nil
+}
+
+// 待機中か確かめて、新しい評価器のイベント列に差し替える
+func (q *Queue) reload(e *Evaluator) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.waiting(); err != nil {
+		return err
+	}
+	program, err := e.Compile(q.curLabel)
+	if err != nil {
+		return err
+	}
+	index := len(program.Events)
+	if q.curIndex < len(q.program.Positions) {
+		index = nearestIndex(program.Positions, q.program.Positions[q.curIndex])
+	}
+
+	q.Evaluator = e
+	q.CurrentLabel = program.Name
+	q.program = program
+	q.WaitingQueue = program.Events[pageStart(program.Events, index):]
+
+	return nil
+}
+
+// ラベルの先頭へ移動して実行する。デバッグ用
+// Reload()と同じく、クリック待ちか選択待ちか、最後まで実行したときだけ移動できる
+func (q *Queue) Goto(label string) error {
+	q.opMu.Lock()
+	defer q.opMu.Unlock()
+
+	if err := q.moveTo(label); err != nil {
+		return err
+	}
+	q.played(label)
+	q.restart()
+	logger.MyLog.Debug("popChan通知@Goto")
+
+	return nil
+}
+
+// 待機中か確かめて、ラベルのイベント列に差し替える
+func (q *Queue) moveTo(label string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.waiting(); err != nil {
+		return err
+	}
+
+	return q.load(label)
+}
+
+// ワーカーが次のイベントを待っているか。ロックを取ってから呼ぶ
+func (q *Queue) waiting() error {
+	if q.cur == nil {
+		return errors.New("開始していない")
+	}
+	if _, ok := q.cur.(Blocker); !ok && !q.Ended() {
+		return ErrBusy
+	}
+
+	return nil
+}
+
+// 表示と文字の装飾と[delay]の指定を消して、WaitingQueueの先頭から実行し直す
+// ワーカーが待機しているときに、opMuを取ってから呼ぶ
+func (q *Queue) restart() {
+	q.ruby = q.buf.reset(0)
+	q.style = Style{}
+	q.delay = nil
+	q.choicesMu.Lock()
+	q.choices = nil
+	q.choicesMu.Unlock()
+	q.ended.Store(false)
+
+	q.runCount.Add(1)
+	q.wg.Add(1)
+	q.popChan <- struct{}{}
+}
+
+// 位置と同じか、後ろにある最初のイベントの番号を返す。ないときはイベント列の長さを返す
+func nearestIndex(positions []token.Position, pos token.Position) int {
+	for i, p := range positions {
+		if p.Line > pos.Line || (p.Line == pos.Line && p.Column >= pos.Column) {
+			return i
+		}
+	}
+
+	return len(positions)
+}
+
+// 番号のイベントを含むページの、先頭のイベントの番号を返す
+// 直前の[p]の次をページの先頭とする。番号がイベント列より後ろのときは、最後のページを返す
+func pageStart(events []Event, index int) int {
+	if index >= len(events) {
+		index = len(events) - 1
+	}
+	for i := index - 1; i >= 0; i-- {
+		if _, ok := events[i].(*Flush); ok {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// 文字を表示するときの設定を返す。設定に、シナリオの[delay]の指定を合わせる
+// 設定でInstantにしているときは、[delay]にかかわらず一気に表示する
+func (q *Queue) messageConfig() Config {
+	config := q.Config()
+	if q.delay == nil {
+		return config
+	}
+	if q.delay.NoWait {
+		config.Instant = true
+	} else {
+		config.MessageSpeed = q.delay.Speed
+	}
+
+	return config
+}
+
+// 現在の設定を取得する
+func (q *Queue) Config() Config {
+	q.configMu.RLock()
+	defer q.configMu.RUnlock()
+
+	return q.config
+}
+
+// 設定を変更する。実行中に変更した場合は、次の文字の表示から反映される
+func (q *Queue) SetConfig(config Config) {
+	q.configMu.Lock()
+	defer q.configMu.Unlock()
+
+	q.config = config
+}
+
 func (q *Queue) Display() string {
-	return q.buf
+	return q.buf.String()
+}
+
+// 表示中の文字列を、装飾とルビの情報つきで行ごとに返す
+// Display()と同じく、アニメーションにあわせて1文字ずつ増えていく
+func (q *Queue) Lines() []Line {
+	return q.buf.lines()
 }
 
 // for debug
 func (q *Queue) DumpQueue() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	result := []string{}
 	for _, e := range q.WaitingQueue {
 		result = append(result, e.String())
@@ -155,3 +613,57 @@ func (q *Queue) DumpQueue() []string {
 
 	return result
 }
+
+// クリック待ちに到達するまでの処理を数える
+// sync.WaitGroupと同じように使えるが、stop()すると数にかかわらず待機を解除する
+type waitGroup struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	n       int
+	stopped bool
+}
+
+func (w *waitGroup) Add(delta int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.n += delta
+	if w.n < 0 {
+		panic("waitGroup: 数が負になった")
+	}
+	if w.n == 0 {
+		w.condLocked().Broadcast()
+	}
+}
+
+func (w *waitGroup) Done() {
+	w.Add(-1)
+}
+
+// 数が0になるか、stop()されるまで待つ
+func (w *waitGroup) Wait() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.n > 0 && !w.stopped {
+		w.condLocked().Wait()
+	}
+}
+
+// 待機を解除し、以降は待たない
+func (w *waitGroup) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	w.condLocked().Broadcast()
+}
+
+// ロックを取ってから呼ぶ
+func (w *waitGroup) condLocked() *sync.Cond {
+	if w.cond == nil {
+		w.cond = sync.NewCond(&w.mu)
+	}
+
+	return w.cond
+}
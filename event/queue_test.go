@@ -1,7 +1,9 @@
 package event
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -70,3 +72,318 @@ func TestWorker_startラベルから開始する(t *testing.T) {
 	q.Wait()
 	assert.Equal(t, "スタート", q.Display())
 }
+
+func TestConfig_キューごとに設定を持つ(t *testing.T) {
+	input := `*start
+あいうえおかきくけこ[p]`
+	q1 := prepareQueue(t, input)
+	q2 := prepareQueue(t, input)
+
+	config := q1.Config()
+	config.LineLen = 5
+	config.Instant = true
+	q1.SetConfig(config)
+	assert.Equal(t, DefaultConfig(), q2.Config())
+
+	q1.Start()
+	q1.Wait()
+	assert.Equal(t, "あいうえお\nかきくけこ", q1.Display())
+
+	q2.Start()
+	q2.Wait()
+	assert.Equal(t, "あいうえおかきくけこ", q2.Display())
+}
+
+func TestConfig_自動送りできる(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[l]
+い[l]`)
+	config := q.Config()
+	config.Instant = true
+	config.AutoAdvance = 10 * time.Millisecond
+	q.SetConfig(config)
+	q.Start()
+
+	assert.Eventually(t, func() bool {
+		return q.Display() == "あ\nい\n"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestEnded_最後まで実行すると待機を解除する(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]
+い`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.False(t, q.Ended())
+	q.Run()
+	q.Wait()
+	assert.True(t, q.Ended())
+	assert.Equal(t, "い", q.Display())
+
+	// 終了後は何もしない
+	q.Run()
+	q.Wait()
+	assert.True(t, q.Ended())
+}
+
+func TestHooks_ラベルとイベントの実行を通知する(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ
+[jump target="next"]
+*next
+い[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	labels := []string{}
+	events := []string{}
+	q.Hooks.OnPlay = func(label string) { labels = append(labels, label) }
+	q.Hooks.OnEvent = func(e Event) { events = append(events, e.String()) }
+	q.Start()
+
+	q.Wait()
+	assert.Equal(t, []string{"start", "next"}, labels)
+	assert.Equal(t, []string{"<MsgEmit あ>", "<Jump next>", "<MsgEmit い>", "<Flush>"}, events)
+	label, index := q.Location()
+	assert.Equal(t, "next", label)
+	assert.Equal(t, 1, index)
+}
+
+func TestStop_ワーカーを止める(t *testing.T) {
+	q := prepareQueue(t, `*start
+[jump target="start"]`)
+	var count atomic.Int32
+	q.Hooks.OnPlay = func(label string) {
+		if count.Add(1) == 3 {
+			q.Stop()
+		}
+	}
+	q.Start()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestStop_待機を解除する(t *testing.T) {
+	q := prepareQueue(t, `*start
+[wait time=200]
+あ[p]`)
+	q.Start()
+
+	done := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(done)
+	}()
+	q.Stop()
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Stop()しても待機を解除しない")
+	}
+}
+
+func TestCoverage_実行したラベルとイベントを記録する(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]
+[jump target="next"]
+*unused
+う[p]
+*next
+い[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	c := NewCoverage()
+	q.Coverage = c
+	q.Start()
+
+	q.Wait()
+	q.Run()
+	q.Wait()
+	assert.Equal(t, 1, c.LabelCount("start"))
+	assert.Equal(t, 1, c.LabelCount("next"))
+	assert.Equal(t, 0, c.LabelCount("unused"))
+	assert.Equal(t, 1, c.EventCount("start", 0))
+	assert.Equal(t, 1, c.EventCount("start", 2))
+	assert.Equal(t, 1, c.EventCount("next", 1))
+	assert.Equal(t, 0, c.EventCount("unused", 0))
+}
+
+func TestReload_同じページから表示し直す(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]
+い[p]
+う[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "い", q.Display())
+
+	assert.NoError(t, q.Reload(prepareQueue(t, `*start
+あ[p]
+いい[p]
+うう[p]`).Evaluator))
+	q.Wait()
+	assert.Equal(t, "いい", q.Display())
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "うう", q.Display())
+}
+
+func TestReload_上の行を書き換えても同じ位置のページから表示し直す(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]
+い[p]
+う[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "い", q.Display())
+
+	// 前のページのイベントが増えても、番号ではなく位置で探す
+	assert.NoError(t, q.Reload(prepareQueue(t, `*start
+あ[l]え[l]お[p]
+いい[p]
+う[p]`).Evaluator))
+	q.Wait()
+	assert.Equal(t, "いい", q.Display())
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "う", q.Display())
+}
+
+func TestReload_消した文字表示速度の指定を使わない(t *testing.T) {
+	q := prepareQueue(t, `*start
+[delay speed="nowait"]
+あ[p]
+い[p]`)
+	q.Start()
+
+	q.Wait()
+	q.Run()
+	q.Wait()
+	assert.True(t, q.messageConfig().Instant)
+
+	assert.NoError(t, q.Reload(prepareQueue(t, `*start
+あ[p]
+い[p]`).Evaluator))
+	q.Wait()
+	assert.Equal(t, "い", q.Display())
+	assert.Equal(t, q.Config(), q.messageConfig())
+}
+
+func TestReload_最後まで実行した後に追加した続きを実行する(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	q.Run()
+	q.Wait()
+	assert.True(t, q.Ended())
+
+	assert.NoError(t, q.Reload(prepareQueue(t, `*start
+あ[p]
+い[p]`).Evaluator))
+	q.Wait()
+	assert.False(t, q.Ended())
+	assert.Equal(t, "あ", q.Display())
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "い", q.Display())
+}
+
+func TestReload_差し替えられないときはエラーを返す(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]`)
+	config := q.Config()
+	config.MessageSpeed = time.Hour
+	q.SetConfig(config)
+	q.Start()
+
+	// 文字の表示中
+	assert.Equal(t, ErrBusy, q.Reload(prepareQueue(t, `*start
+い[p]`).Evaluator))
+	q.Run()
+	q.Wait()
+	// ラベルがなくなった
+	assert.Error(t, q.Reload(prepareQueue(t, `*other
+い[p]`).Evaluator))
+	assert.Equal(t, "あ", q.Display())
+}
+
+func TestSnapshot_処理中のタスクの状態をまとめて返す(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[l]
+い[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	s := q.Snapshot()
+	assert.Equal(t, "start", s.Label)
+	assert.Equal(t, 1, s.Index)
+	assert.Equal(t, 2, s.Pos.Line)
+	assert.Equal(t, "<LineEndWait>", s.Event.String())
+	rest := []string{}
+	for _, e := range s.Rest {
+		rest = append(rest, e.String())
+	}
+	assert.Equal(t, []string{"<MsgEmit い>", "<Flush>"}, rest)
+}
+
+func TestGoto_文字の装飾を元に戻す(t *testing.T) {
+	q := prepareQueue(t, `*start
+[font bold="true"]あ[p]
+*next
+い[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.NoError(t, q.Goto("next"))
+	q.Wait()
+	assert.Equal(t, []Line{{{Text: "い"}}}, q.Lines())
+}
+
+func TestGoto_ラベルの先頭へ移動する(t *testing.T) {
+	q := prepareQueue(t, `*start
+あ[p]
+い[p]
+*next
+う[p]`)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	q.Start()
+
+	q.Wait()
+	assert.NoError(t, q.Goto("next"))
+	q.Wait()
+	assert.Equal(t, "う", q.Display())
+	assert.Equal(t, "next", q.CurrentLabel)
+	assert.Error(t, q.Goto("not exists"))
+}
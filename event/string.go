@@ -1,30 +1,170 @@
 package event
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+const (
+	// 行頭禁則文字。行の先頭に来てはいけない
+	lineStartForbidden = "、。，．,.・：；？！:;?!‐゠–〜～゛゜ヽヾゝゞ々〻ー）］｝〕〉》」』】〙〗’”)]}ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ…‥"
+	// 行末禁則文字。行の末尾に来てはいけない
+	lineEndForbidden = "（［｛〔〈《「『【〘〖‘“([{"
+	// 分離禁止文字。連続しているときは間で改行しない
+	inseparable = "…‥―"
+	// ぶら下げできる文字
+	hangable = "、。，．,."
+)
+
+// 折り返し位置を決める
+type lineBreaker struct {
+	// 文字の描画幅を測る
+	measurer Measurer
+	// 1行の幅
+	limit float64
+	// 句読点のぶら下げを許可するか
+	hanging bool
+}
+
+// 設定から生成する。Measurerがなければ、全角1文字を幅1とする等幅フォントとみなして文字数で折り返す
+func newLineBreaker(config Config) lineBreaker {
+	if config.Measurer != nil {
+		return lineBreaker{
+			measurer: config.Measurer,
+			limit:    config.LineWidth,
+			hanging:  config.Hanging,
+		}
+	}
+
+	return lineBreaker{
+		measurer: FixedWidthMeasurer{Size: 1},
+		limit:    float64(config.LineLen),
+		hanging:  config.Hanging,
+	}
+}
 
 // 直近の行を見て、横幅を超えていたら改行
 func autoNewline(buf string, chunkSize int) string {
-	split := strings.Split(buf, "\n")
-	last := split[len(split)-1]
+	return newLineBreaker(Config{LineLen: chunkSize}).wrap(buf)
+}
 
-	var latestLine strings.Builder
-	runes := []rune(last)
-	for i, r := range runes {
-		latestLine.WriteRune(r)
-		// 文末の場合は改行を追加しない
-		if (i+1)%chunkSize == 0 && i+1 != len(runes) {
-			latestLine.WriteString("\n")
+// 直近の行を折り返す
+func (b lineBreaker) wrap(buf string) string {
+	idx := strings.LastIndex(buf, "\n")
+	runes := []rune(buf[idx+1:])
+
+	return buf[:idx+1] + insertBreaks(runes, b.breaks(runes, nil))
+}
+
+// 改行を挿入する位置を返す。位置の文字の前で改行する
+// 文末には改行を追加しない
+// groupsは文字ごとのルビの番号で、同じルビがふられた文字の間では改行しない。nilのときは考慮しない
+func (b lineBreaker) breaks(runes []rune, groups []int) []int {
+	result := []int{}
+	start := 0      // 現在行の先頭
+	w := float64(0) // 現在行の幅
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' {
+			start = i + 1
+			w = 0
+			continue
+		}
+		w += b.measurer.Advance(string(r))
+		if w <= b.limit || i == start {
+			continue
+		}
+
+		// 空白ははみ出しても次の行に送らない
+		if unicode.IsSpace(r) {
+			continue
+		}
+		// 句読点をぶら下げ、次の文字から次の行にする
+		if b.hanging && strings.ContainsRune(hangable, r) {
+			next := i + 1
+			if next >= len(runes) || runes[next] == '\n' {
+				continue
+			}
+			if !strings.ContainsRune(lineStartForbidden, runes[next]) {
+				result = append(result, next)
+				start = next
+				w = 0
+				continue
+			}
 		}
-	}
 
-	var result string
-	if len(split) > 1 {
-		// 加工した末尾以外は元に戻す
-		original := strings.Join(split[0:len(split)-1], "\n")
-		result = original + "\n" + latestLine.String()
-	} else {
-		result = latestLine.String()
+		// 改行できる位置まで戻る。見つからなければ強制的に改行する
+		pos := i
+		for pos > start && !canBreak(runes, groups, pos) {
+			pos--
+		}
+		if pos == start {
+			pos = i
+		}
+		result = append(result, pos)
+		start = pos
+		w = b.measurer.Advance(string(runes[pos : i+1]))
 	}
 
 	return result
 }
+
+// 位置の文字の前で改行してよいか判定する
+func canBreak(runes []rune, groups []int, i int) bool {
+	prev, cur := runes[i-1], runes[i]
+	switch {
+	case groups != nil && groups[i] != 0 && groups[i] == groups[i-1]:
+		// ルビがふられた文字列は分割しない
+		return false
+	case strings.ContainsRune(lineStartForbidden, cur):
+		return false
+	case strings.ContainsRune(lineEndForbidden, prev):
+		return false
+	case prev == cur && strings.ContainsRune(inseparable, cur):
+		return false
+	case unicode.IsSpace(cur):
+		return false
+	case isWordRune(prev) && isWordRune(cur):
+		// 欧文の単語は分割しない
+		return false
+	}
+
+	return true
+}
+
+// 欧文の単語を構成する文字か判定する
+func isWordRune(r rune) bool {
+	return runeWidth(r) == 1 && !unicode.IsSpace(r)
+}
+
+// 表示幅を返す。半角を1、全角を2とする
+// 日本語環境を想定しているので、記号類の曖昧幅文字は全角として扱う
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	case width.EastAsianAmbiguous:
+		if r >= 0x2000 {
+			return 2
+		}
+	}
+
+	return 1
+}
+
+// 指定位置に改行を挿入した文字列を返す
+func insertBreaks(runes []rune, breaks []int) string {
+	var b strings.Builder
+	j := 0
+	for i, r := range runes {
+		if j < len(breaks) && breaks[j] == i {
+			b.WriteString("\n")
+			j++
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -29,10 +29,164 @@ func TestAutoNewline(t *testing.T) {
 	)
 	assert.Equal(t,
 		"abcdefghij\nklmno",
-		autoNewline("abcdefghijklmno", 10),
+		autoNewline("abcdefghijklmno", 5),
 	)
 	assert.Equal(t,
 		"あいうえお\nかきくけこ\nさしすせそ",
 		autoNewline("あいうえおかきくけこさしすせそ", 5),
 	)
 }
+
+func TestAutoNewline_禁則処理(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		lineLen int
+		hanging bool
+		expect  string
+	}{
+		{
+			name:    "半角は全角の半分の幅として数える",
+			input:   "abcdefghijあいうえお",
+			lineLen: 10,
+			expect:  "abcdefghijあいうえお",
+		},
+		{
+			name:    "行頭禁則文字は前の文字ごと次の行に送る",
+			input:   "あいうえお。かきくけこ",
+			lineLen: 5,
+			expect:  "あいうえ\nお。かきく\nけこ",
+		},
+		{
+			name:    "閉じ括弧は行頭に来ない",
+			input:   "「あいうえ」かきくけこ",
+			lineLen: 5,
+			expect:  "「あいう\nえ」かきく\nけこ",
+		},
+		{
+			name:    "開き括弧は行末に来ない",
+			input:   "あいうえ「おか」",
+			lineLen: 5,
+			expect:  "あいうえ\n「おか」",
+		},
+		{
+			name:    "小書きの仮名は行頭に来ない",
+			input:   "あいうえちょっと",
+			lineLen: 5,
+			expect:  "あいうえ\nちょっと",
+		},
+		{
+			name:    "連続した三点リーダは分割しない",
+			input:   "あいうえ……",
+			lineLen: 5,
+			expect:  "あいう\nえ……",
+		},
+		{
+			name:    "ぶら下げが有効なときは句読点を行末にはみ出させる",
+			input:   "あいうえお。かきくけこ",
+			lineLen: 5,
+			hanging: true,
+			expect:  "あいうえお。\nかきくけこ",
+		},
+		{
+			name:    "ぶら下げた句読点のあとが行頭禁則文字のときは追い出す",
+			input:   "「あいうえ。」かきく",
+			lineLen: 5,
+			hanging: true,
+			expect:  "「あいう\nえ。」かき\nく",
+		},
+		{
+			name:    "欧文は単語の途中で改行しない",
+			input:   "hello world foo bar",
+			lineLen: 4,
+			expect:  "hello \nworld \nfoo bar",
+		},
+		{
+			name:    "1行に収まらない単語は途中で改行する",
+			input:   "internationalization",
+			lineLen: 4,
+			expect:  "internat\nionaliza\ntion",
+		},
+		{
+			name:    "和文と欧文の間では改行できる",
+			input:   "これはGopherです",
+			lineLen: 4,
+			expect:  "これは\nGopherで\nす",
+		},
+		{
+			name:    "直近の行だけを折り返す",
+			input:   "あいうえおかき\nくけこさしすせそ",
+			lineLen: 5,
+			expect:  "あいうえおかき\nくけこさし\nすせそ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newLineBreaker(Config{LineLen: tt.lineLen, Hanging: tt.hanging})
+			assert.Equal(t, tt.expect, b.wrap(tt.input))
+		})
+	}
+}
+
+// 文字ごとに幅を指定できる、プロポーショナルフォントを模したもの
+type mockMeasurer map[rune]float64
+
+func (m mockMeasurer) Advance(s string) float64 {
+	w := float64(0)
+	for _, r := range s {
+		if v, ok := m[r]; ok {
+			w += v
+		} else {
+			w += 10
+		}
+	}
+
+	return w
+}
+
+func TestAutoNewline_描画幅で折り返す(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		measurer  Measurer
+		lineWidth float64
+		expect    string
+	}{
+		{
+			name:      "等幅フォントでは全角の文字数で折り返す",
+			input:     "あいうえおかきくけこ",
+			measurer:  FixedWidthMeasurer{Size: 20},
+			lineWidth: 100,
+			expect:    "あいうえお\nかきくけこ",
+		},
+		{
+			name:      "等幅フォントでは半角を全角の半分の幅とする",
+			input:     "abcdefghijklmno",
+			measurer:  FixedWidthMeasurer{Size: 20},
+			lineWidth: 100,
+			expect:    "abcdefghij\nklmno",
+		},
+		{
+			name:      "幅の狭い文字は多く詰める",
+			input:     "ああああああああああんんんん",
+			measurer:  mockMeasurer{'あ': 4, 'ん': 10},
+			lineWidth: 50,
+			expect:    "ああああああああああん\nんんん",
+		},
+		{
+			name:      "幅ちょうどに収まる場合は改行しない",
+			input:     "mmmmm",
+			measurer:  mockMeasurer{'m': 10},
+			lineWidth: 50,
+			expect:    "mmmmm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newLineBreaker(Config{Measurer: tt.measurer, LineWidth: tt.lineWidth})
+			assert.Equal(t, tt.expect, b.wrap(tt.input))
+		})
+	}
+}
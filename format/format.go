@@ -0,0 +1,164 @@
+// シナリオファイルを正規化した形式で書き出すパッケージ
+package format
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/token"
+)
+
+// シナリオを正規化する
+// - コマンドの空白を詰め、パラメータを名前順に並べる。文字列はダブルクォートで囲む
+// - ラベルの前に空行を1行入れ、ラベルの直後の空行は取り除く
+// - 連続する空行は1行にまとめ、行末の空白とファイル末尾の空行を取り除く
+// - コメントは書かれていた位置に残す
+func Source(src []byte) ([]byte, error) {
+	l := lexer.NewLexer(string(src))
+	p := parser.NewParser(l)
+	program, err := p.ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := Fprint(&b, program); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// ASTを正規化した形式で書き出す
+func Fprint(w io.Writer, program *ast.Program) error {
+	p := printer{lines: []string{}}
+	p.statements(program.Statements)
+	p.comments(program.Comments)
+	p.flush()
+
+	lines := []string{}
+	for _, line := range p.lines {
+		// 連続する空行はまとめる
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = trimBlankLines(lines)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+
+	return err
+}
+
+type printer struct {
+	// 確定した行
+	lines []string
+	// 書き込み中の行
+	cur strings.Builder
+	// ラベルの本文をまだ書いていないか。ラベル直後の空行を取り除くのに使う
+	afterLabel bool
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for _, s := range statements {
+		stmt, ok := s.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		// ラベルのコメントは、ラベルの前の空行のあとに書く
+		if _, isLabel := stmt.Expression.(*ast.LabelLiteral); !isLabel {
+			p.comments(stmt.Comments)
+		}
+		switch node := stmt.Expression.(type) {
+		case nil:
+			if stmt.Token.Type == token.NEWLINE {
+				p.newline()
+			}
+		case *ast.TextLiteral:
+			p.write(EscapeText(node.Value, p.cur.Len() == 0))
+		case *ast.CmdLiteral:
+			p.write(node.String())
+		case *ast.LabelLiteral:
+			p.label(node, stmt.Comments)
+		}
+	}
+}
+
+func (p *printer) write(s string) {
+	p.cur.WriteString(s)
+	p.afterLabel = false
+}
+
+// 書き込み中の行を確定する
+func (p *printer) newline() {
+	if p.afterLabel && p.cur.Len() == 0 {
+		return
+	}
+	p.lines = append(p.lines, strings.TrimRight(p.cur.String(), " \t"))
+	p.cur.Reset()
+}
+
+// 書き込み中の行があれば確定する
+func (p *printer) flush() {
+	if p.cur.Len() > 0 {
+		p.newline()
+	}
+}
+
+func (p *printer) label(node *ast.LabelLiteral, comments []*ast.Comment) {
+	p.flush()
+	p.lines = trimBlankLines(p.lines)
+	if len(p.lines) > 0 {
+		p.lines = append(p.lines, "")
+	}
+	p.comments(comments)
+	p.lines = append(p.lines, token.ASTERISK+strings.TrimSpace(node.LabelName.Value))
+	p.afterLabel = true
+	if node.Body != nil {
+		p.statements(node.Body.Statements)
+	}
+}
+
+// コメントを1行ずつ書く
+// ブロックコメントは中の空行をまとめないように、改行を含めて1行として扱う
+func (p *printer) comments(comments []*ast.Comment) {
+	for _, c := range comments {
+		p.flush()
+		p.lines = append(p.lines, c.String())
+		p.afterLabel = false
+	}
+}
+
+// 本文をエスケープする
+// 行頭ではコメントと区別できるように、コメントの記号もエスケープする
+func EscapeText(s string, lineStart bool) string {
+	var out strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '[' || r == ']' || r == '\\':
+			out.WriteRune('\\')
+		case i == 0 && lineStart && (r == ';' || strings.HasPrefix(s, "/*")):
+			out.WriteRune('\\')
+		}
+		out.WriteRune(r)
+	}
+
+	return out.String()
+}
+
+// 末尾の空行を取り除く
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
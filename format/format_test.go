@@ -0,0 +1,174 @@
+package format
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{
+			name:   "コマンドの空白を詰める",
+			input:  "[image   source = \"test.png\"  ]\n",
+			expect: "[image source=\"test.png\"]\n",
+		},
+		{
+			name:   "シングルクォートはダブルクォートにする",
+			input:  "[example a='say \"hi\"' b=\"it's\"]\n",
+			expect: "[example a=\"say \\\"hi\\\"\" b=\"it's\"]\n",
+		},
+		{
+			name:   "数値と識別子はクォートしない",
+			input:  "[wait time=500][font size=1.5][jump target=ch1]\n",
+			expect: "[wait time=500][font size=1.5][jump target=ch1]\n",
+		},
+		{
+			name:   "本文の記号をエスケープする",
+			input:  "\\; コメントではない\\[p\\] \\\\ \"引用\"=\n",
+			expect: "\\; コメントではない\\[p\\] \\\\ \"引用\"=\n",
+		},
+		{
+			name:   "パラメータを名前順に並べる",
+			input:  "[example c=\"3\" a=\"1\" b=\"2\"]\n",
+			expect: "[example a=\"1\" b=\"2\" c=\"3\"]\n",
+		},
+		{
+			name: "ラベルの前に空行を1行入れる",
+			input: `*start
+あいう[p]
+*ch1
+えお[p]
+`,
+			expect: `*start
+あいう[p]
+
+*ch1
+えお[p]
+`,
+		},
+		{
+			name: "ラベルの直後の空行と、連続する空行をまとめる",
+			input: `*start
+
+
+あいう[p]
+
+
+
+えお[p]
+
+
+*ch1
+
+かき[p]`,
+			expect: `*start
+あいう[p]
+
+えお[p]
+
+*ch1
+かき[p]
+`,
+		},
+		{
+			name:   "ラベル名の前後の空白を取り除く",
+			input:  "*start  \nあ[p]\n",
+			expect: "*start\nあ[p]\n",
+		},
+		{
+			name:   "行末の空白を取り除く",
+			input:  "*start\nあいう   \n[p]  \n",
+			expect: "*start\nあいう\n[p]\n",
+		},
+		{
+			name: "コメントを残す",
+			input: `; 先頭
+*start
+; 本文の前
+あいう[p]
+
+/* ラベルの前
+
+
+*/
+*ch1
+
+; 本文
+えお[p]
+; 末尾
+`,
+			expect: `; 先頭
+*start
+; 本文の前
+あいう[p]
+
+/* ラベルの前
+
+
+*/
+*ch1
+; 本文
+えお[p]
+; 末尾
+`,
+		},
+		{
+			name:   "空のファイルはそのまま",
+			input:  "",
+			expect: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Source([]byte(tt.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, string(result))
+		})
+	}
+}
+
+func TestSource_シンタックスエラーを返す(t *testing.T) {
+	_, err := Source([]byte(`[example a]`))
+	assert.Error(t, err)
+}
+
+func TestSource_冪等である(t *testing.T) {
+	example, err := os.ReadFile("../_example/input.sce")
+	assert.NoError(t, err)
+	inputs := []string{
+		string(example),
+		"*start\n\n\n[image   source=\"a.png\"]\nあ[l]い[r]\n[p]\n*end\n[jump  target=\"start\"]",
+		"前置き[p]\n*start\nあ",
+	}
+
+	for _, input := range inputs {
+		first, err := Source([]byte(input))
+		assert.NoError(t, err)
+		second, err := Source(first)
+		assert.NoError(t, err)
+		assert.Equal(t, string(first), string(second))
+
+		// 書式を整えても構文木は変わらない
+		assert.Equal(t, parse(t, input), parse(t, string(first)))
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	t.Helper()
+
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	program, err := p.ParseProgram()
+	assert.NoError(t, err)
+
+	return program.String()
+}
@@ -2,7 +2,11 @@ module github.com/kijimaD/nova
 
 go 1.20
 
-require github.com/stretchr/testify v1.9.0
+require (
+	github.com/hajimehoshi/ebiten/v2 v2.7.10
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/text v0.18.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -12,7 +16,6 @@ require (
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20200707082815-5321531c36a2 // indirect
 	github.com/go-text/typesetting v0.1.1-0.20240325125605-c7936fe59984 // indirect
 	github.com/hajimehoshi/ebiten v1.12.12 // indirect
-	github.com/hajimehoshi/ebiten/v2 v2.7.10 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/exp v0.0.0-20190731235908-ec7cb31e5a56 // indirect
@@ -20,6 +23,5 @@ require (
 	golang.org/x/mobile v0.0.0-20210208171126-f462b3930c8f // indirect
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
-	golang.org/x/text v0.18.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,387 @@
+// ラベル間の遷移をグラフにするパッケージ
+// シナリオの流れを図にしたり、行き止まりや抜けられないループを見つけたりするのに使う
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/token"
+)
+
+// 最初に再生するラベル
+const StartLabel = "start"
+
+// 遷移の種類
+type EdgeKind string
+
+const (
+	// 無条件の遷移
+	EdgeJump EdgeKind = "jump"
+	// 選択肢による遷移
+	EdgeChoice EdgeKind = "choice"
+)
+
+// ラベル間の遷移
+type Edge struct {
+	From string
+	To   string
+	Kind EdgeKind
+	// 遷移するイベントのソース上の位置
+	Pos token.Position
+}
+
+// ラベルをノード、遷移を辺とする有向グラフ
+type Graph struct {
+	// 定義順のラベル名
+	Labels []string
+	Edges  []Edge
+	// 本文を表示しないラベル
+	silent map[string]bool
+}
+
+// 評価器に登録されているすべてのラベルをコンパイルして、グラフを作る
+func Build(e *event.Evaluator) (*Graph, error) {
+	labels, err := e.CompileAll()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{Labels: []string{}, Edges: []Edge{}, silent: map[string]bool{}}
+	for _, label := range labels {
+		g.Labels = append(g.Labels, label.Name)
+		g.silent[label.Name] = true
+	events:
+		for i, eve := range label.Events {
+			switch eve := eve.(type) {
+			case *event.MsgEmit:
+				g.silent[label.Name] = false
+			case *event.Jump:
+				g.Edges = append(g.Edges, Edge{From: label.Name, To: eve.Target, Kind: EdgeJump, Pos: label.Positions[i]})
+				// 無条件に遷移するので、後ろのイベントは実行しない
+				break events
+			case *event.Choice:
+				g.Edges = append(g.Edges, Edge{From: label.Name, To: eve.Target, Kind: EdgeChoice, Pos: label.Positions[i]})
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// ラベルから出ている遷移を返す
+func (g *Graph) outgoing(label string) []Edge {
+	result := []Edge{}
+	for _, e := range g.Edges {
+		if e.From == label {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+func (g *Graph) has(label string) bool {
+	for _, l := range g.Labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+// グラフを調べた結果
+type Report struct {
+	// 遷移先がないラベル。エンディングとみなし、問題には数えない
+	Endings []string
+	// 遷移先も本文もないラベル。ジャンプの書き忘れの可能性がある
+	DeadEnds []string
+	// 選択肢を含まず、抜け出せないループ。ラベルの並びで表す
+	Cycles [][]string
+	// startから到達できないラベル
+	Unreachable []string
+	// 存在しないラベルへの遷移
+	Missing []Edge
+}
+
+// 問題が見つかったか。エンディングは問題に数えない
+func (r Report) HasProblems() bool {
+	return len(r.DeadEnds)+len(r.Cycles)+len(r.Unreachable)+len(r.Missing) > 0
+}
+
+func (r Report) String() string {
+	var out strings.Builder
+	for _, l := range r.DeadEnds {
+		fmt.Fprintf(&out, "行き止まり: %s\n", l)
+	}
+	for _, c := range r.Cycles {
+		fmt.Fprintf(&out, "抜け出せないループ: %s -> %s\n", strings.Join(c, " -> "), c[0])
+	}
+	for _, l := range r.Unreachable {
+		fmt.Fprintf(&out, "到達できない: %s\n", l)
+	}
+	for _, e := range r.Missing {
+		fmt.Fprintf(&out, "%s: 存在しないラベルへの遷移: %s -> %s\n", e.Pos, e.From, e.To)
+	}
+
+	return out.String()
+}
+
+// グラフを調べる
+func (g *Graph) Analyze() Report {
+	r := Report{Endings: []string{}, DeadEnds: []string{}, Cycles: [][]string{}, Unreachable: []string{}, Missing: []Edge{}}
+
+	for _, l := range g.Labels {
+		if len(g.outgoing(l)) > 0 {
+			continue
+		}
+		r.Endings = append(r.Endings, l)
+		if g.silent[l] {
+			r.DeadEnds = append(r.DeadEnds, l)
+		}
+	}
+	for _, e := range g.Edges {
+		if !g.has(e.To) {
+			r.Missing = append(r.Missing, e)
+		}
+	}
+
+	reached := map[string]bool{}
+	if g.has(StartLabel) {
+		stack := []string{StartLabel}
+		reached[StartLabel] = true
+		for len(stack) > 0 {
+			l := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range g.outgoing(l) {
+				if !reached[e.To] && g.has(e.To) {
+					reached[e.To] = true
+					stack = append(stack, e.To)
+				}
+			}
+		}
+	}
+	for _, l := range g.Labels {
+		if !reached[l] {
+			r.Unreachable = append(r.Unreachable, l)
+		}
+	}
+
+	for _, scc := range g.components() {
+		if g.isTrap(scc) {
+			r.Cycles = append(r.Cycles, scc)
+		}
+	}
+
+	return r
+}
+
+// 強連結成分のうち、ループになっているものを返す。Tarjanのアルゴリズムを使う
+// 各成分はラベルの定義順に並べる
+func (g *Graph) components() [][]string {
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	result := [][]string{}
+	order := map[string]int{}
+	for i, l := range g.Labels {
+		order[l] = i
+	}
+
+	var visit func(l string)
+	visit = func(l string) {
+		index[l] = len(index)
+		low[l] = index[l]
+		stack = append(stack, l)
+		onStack[l] = true
+
+		for _, e := range g.outgoing(l) {
+			if !g.has(e.To) {
+				continue
+			}
+			if _, ok := index[e.To]; !ok {
+				visit(e.To)
+				if low[e.To] < low[l] {
+					low[l] = low[e.To]
+				}
+			} else if onStack[e.To] && index[e.To] < low[l] {
+				low[l] = index[e.To]
+			}
+		}
+
+		if low[l] != index[l] {
+			return
+		}
+		scc := []string{}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == l {
+				break
+			}
+		}
+		if len(scc) > 1 || g.hasSelfLoop(l) {
+			sort.Slice(scc, func(i, j int) bool { return order[scc[i]] < order[scc[j]] })
+			result = append(result, scc)
+		}
+	}
+	for _, l := range g.Labels {
+		if _, ok := index[l]; !ok {
+			visit(l)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return order[result[i][0]] < order[result[j][0]] })
+
+	return result
+}
+
+func (g *Graph) hasSelfLoop(label string) bool {
+	for _, e := range g.outgoing(label) {
+		if e.To == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ループから抜け出せないか判定する
+// ループ内のラベルがすべて、ループ内への無条件の遷移しか持たないときに抜け出せない
+func (g *Graph) isTrap(scc []string) bool {
+	in := map[string]bool{}
+	for _, l := range scc {
+		in[l] = true
+	}
+	for _, l := range scc {
+		for _, e := range g.outgoing(l) {
+			if e.Kind != EdgeJump || !in[e.To] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Graphvizのdot形式で書き込む
+// エンディングは二重丸、到達できないラベルは破線、存在しない遷移先は赤で表す
+func (g *Graph) WriteDOT(w io.Writer) error {
+	r := g.Analyze()
+	var out strings.Builder
+
+	out.WriteString("digraph scenario {\n")
+	for _, l := range g.Labels {
+		attrs := []string{}
+		if contains(r.Endings, l) {
+			attrs = append(attrs, "shape=doublecircle")
+		}
+		if contains(r.Unreachable, l) {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&out, "  %s%s;\n", dotQuote(l), dotAttrs(attrs))
+	}
+	for _, l := range missingTargets(r.Missing) {
+		fmt.Fprintf(&out, "  %s [color=red];\n", dotQuote(l))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&out, "  %s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+	out.WriteString("}\n")
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func dotAttrs(attrs []string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+
+	return " [" + strings.Join(attrs, ", ") + "]"
+}
+
+// Mermaidのフローチャート形式で書き込む
+// ラベル名には記号が入りうるので、ノードIDは連番にする
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	r := g.Analyze()
+	var out strings.Builder
+
+	ids := map[string]string{}
+	id := func(label string) string {
+		if v, ok := ids[label]; ok {
+			return v
+		}
+		ids[label] = fmt.Sprintf("n%d", len(ids))
+		return ids[label]
+	}
+
+	out.WriteString("flowchart TD\n")
+	for _, l := range g.Labels {
+		fmt.Fprintf(&out, "  %s[%s]\n", id(l), mermaidQuote(l))
+	}
+	for _, l := range missingTargets(r.Missing) {
+		fmt.Fprintf(&out, "  %s[%s]\n", id(l), mermaidQuote(l))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&out, "  %s --> %s\n", id(e.From), id(e.To))
+	}
+	classes := []struct {
+		name   string
+		style  string
+		labels []string
+	}{
+		{"ending", "stroke-width:4px", r.Endings},
+		{"unreachable", "stroke-dasharray:5 5", r.Unreachable},
+		{"missing", "stroke:#f00", missingTargets(r.Missing)},
+	}
+	for _, c := range classes {
+		if len(c.labels) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "  classDef %s %s\n", c.name, c.style)
+		nodes := []string{}
+		for _, l := range c.labels {
+			nodes = append(nodes, id(l))
+		}
+		fmt.Fprintf(&out, "  class %s %s\n", strings.Join(nodes, ","), c.name)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+func missingTargets(edges []Edge) []string {
+	result := []string{}
+	for _, e := range edges {
+		if !contains(result, e.To) {
+			result = append(result, e.To)
+		}
+	}
+
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
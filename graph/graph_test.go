@@ -0,0 +1,178 @@
+package graph
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/token"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `*start
+はじまり[p]
+[jump target=ch1]
+*ch1
+第一章[p]
+[jump target=ch2]
+*ch2
+第二章[p]
+[jump target=ch1]
+*ending
+おわり[p]
+*typo
+[jump target=chx]`
+
+func build(t *testing.T, input string) *Graph {
+	t.Helper()
+
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	g, err := Build(e)
+	assert.NoError(t, err)
+
+	return g
+}
+
+func TestBuild(t *testing.T) {
+	g := build(t, input)
+
+	assert.Equal(t, []string{"start", "ch1", "ch2", "ending", "typo"}, g.Labels)
+	assert.Equal(t, []Edge{
+		{From: "start", To: "ch1", Kind: EdgeJump, Pos: token.Position{Offset: 23, Line: 3, Column: 1}},
+		{From: "ch1", To: "ch2", Kind: EdgeJump, Pos: token.Position{Offset: 59, Line: 6, Column: 1}},
+		{From: "ch2", To: "ch1", Kind: EdgeJump, Pos: token.Position{Offset: 95, Line: 9, Column: 1}},
+		{From: "typo", To: "chx", Kind: EdgeJump, Pos: token.Position{Offset: 140, Line: 13, Column: 1}},
+	}, g.Edges)
+}
+
+func TestAnalyze(t *testing.T) {
+	g := build(t, input)
+	r := g.Analyze()
+
+	assert.True(t, r.HasProblems())
+	assert.Equal(t, []string{"ending"}, r.Endings)
+	assert.Equal(t, 0, len(r.DeadEnds))
+	assert.Equal(t, [][]string{{"ch1", "ch2"}}, r.Cycles)
+	assert.Equal(t, []string{"ending", "typo"}, r.Unreachable)
+	assert.Equal(t, 1, len(r.Missing))
+	assert.Equal(t, `抜け出せないループ: ch1 -> ch2 -> ch1
+到達できない: ending
+到達できない: typo
+13:1: 存在しないラベルへの遷移: typo -> chx
+`, r.String())
+}
+
+func TestAnalyze_エンディングは問題にしない(t *testing.T) {
+	g := build(t, `*start
+[jump target="第一章"]
+*第一章
+おわり[p]`)
+	r := g.Analyze()
+
+	assert.False(t, r.HasProblems())
+	assert.Equal(t, []string{"第一章"}, r.Endings)
+	assert.Equal(t, 0, len(r.DeadEnds))
+	assert.Equal(t, 0, len(r.Cycles))
+	assert.Equal(t, 0, len(r.Unreachable))
+	assert.Equal(t, 0, len(r.Missing))
+	assert.Equal(t, "", r.String())
+}
+
+func TestAnalyze_本文のない行き止まりを報告する(t *testing.T) {
+	g := build(t, `*start
+はじまり[p]
+[jump target="empty"]
+*empty
+[wait time=100]`)
+	r := g.Analyze()
+
+	assert.True(t, r.HasProblems())
+	assert.Equal(t, []string{"empty"}, r.Endings)
+	assert.Equal(t, []string{"empty"}, r.DeadEnds)
+	assert.Equal(t, "行き止まり: empty\n", r.String())
+}
+
+func TestBuild_最初のジャンプより後ろの遷移は数えない(t *testing.T) {
+	g := build(t, `*start
+[jump target="a"]
+[jump target="b"]
+*a
+あ[p]
+*b
+い[p]`)
+
+	assert.Equal(t, []Edge{
+		{From: "start", To: "a", Kind: EdgeJump, Pos: token.Position{Offset: 7, Line: 2, Column: 1}},
+	}, g.Edges)
+	assert.Equal(t, []string{"b"}, g.Analyze().Unreachable)
+}
+
+func TestAnalyze_選択肢で抜け出せるループは報告しない(t *testing.T) {
+	g := build(t, `*start
+もう一度？[l]
+[choice text="はい" target=start]
+[choice text="いいえ" target=ending]
+[select]
+*ending
+おわり[p]`)
+	r := g.Analyze()
+
+	assert.Equal(t, []Edge{
+		{From: "start", To: "start", Kind: EdgeChoice, Pos: token.Position{Offset: 26, Line: 3, Column: 1}},
+		{From: "start", To: "ending", Kind: EdgeChoice, Pos: token.Position{Offset: 62, Line: 4, Column: 1}},
+	}, g.Edges)
+	assert.Equal(t, 0, len(r.Cycles))
+	assert.Equal(t, []string{"ending"}, r.Endings)
+}
+
+func TestWriteDOT(t *testing.T) {
+	g := build(t, input)
+
+	var buf bytes.Buffer
+	assert.NoError(t, g.WriteDOT(&buf))
+	expect := `digraph scenario {
+  "start";
+  "ch1";
+  "ch2";
+  "ending" [shape=doublecircle, style=dashed];
+  "typo" [style=dashed];
+  "chx" [color=red];
+  "start" -> "ch1";
+  "ch1" -> "ch2";
+  "ch2" -> "ch1";
+  "typo" -> "chx";
+}
+`
+	assert.Equal(t, expect, buf.String())
+}
+
+func TestWriteMermaid(t *testing.T) {
+	g := build(t, input)
+
+	var buf bytes.Buffer
+	assert.NoError(t, g.WriteMermaid(&buf))
+	expect := `flowchart TD
+  n0["start"]
+  n1["ch1"]
+  n2["ch2"]
+  n3["ending"]
+  n4["typo"]
+  n5["chx"]
+  n0 --> n1
+  n1 --> n2
+  n2 --> n1
+  n4 --> n5
+  classDef ending stroke-width:4px
+  class n3 ending
+  classDef unreachable stroke-dasharray:5 5
+  class n3,n4 unreachable
+  classDef missing stroke:#f00
+  class n5 missing
+`
+	assert.Equal(t, expect, buf.String())
+}
@@ -0,0 +1,394 @@
+// シナリオを画面なしで通しで実行するパッケージ
+// クリック待ちを自動で進め、選択肢は指定した順か総当たりで選び、表示した内容を記録する
+// CIですべてのルートを最後まで読めるか確かめるのに使う
+package headless
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+)
+
+const (
+	// 最初に再生するラベル
+	StartLabel = "start"
+	// クリック待ちになるまで待つ時間の上限のデフォルト
+	DefaultTimeout = 5 * time.Second
+	// 1ルートあたりのクリック待ちの回数の上限のデフォルト
+	DefaultMaxPages = 10000
+	// 総当たりで試すルート数の上限のデフォルト
+	DefaultMaxRoutes = 1000
+)
+
+var (
+	// 選択肢を挟まずに、同じ場所へ戻ってきた。抜け出せない
+	ErrLoop = errors.New("無限ループ")
+	// 時間内にクリック待ちにならなかった
+	ErrStuck = errors.New("進行が止まった")
+	// クリック待ちの回数が上限を超えた
+	ErrTooLong = errors.New("クリック待ちの回数が上限を超えた")
+	// ルート数が上限を超えた
+	ErrTooManyRoutes = errors.New("ルート数が上限を超えた")
+)
+
+// 記録の種類
+type EntryKind string
+
+const (
+	// ラベルの再生
+	EntryLabel EntryKind = "label"
+	// 表示した本文
+	EntryPage EntryKind = "page"
+	// クライアントへの通知
+	EntryNotify EntryKind = "notify"
+	// 選んだ選択肢
+	EntryChoice EntryKind = "choice"
+	// 実行したイベント。Runner.RecordEventsのときだけ記録する
+	EntryEvent EntryKind = "event"
+)
+
+// 記録の1項目
+type Entry struct {
+	Kind EntryKind `json:"kind"`
+	Text string    `json:"text"`
+}
+
+// 1ルートを実行した記録
+type Transcript struct {
+	// 選んだ選択肢の番号。0始まり
+	Choices []int `json:"choices"`
+	// 再生したラベル。再生した順に並べる
+	Labels []string `json:"labels"`
+	// 実行した順の記録
+	Entries []Entry `json:"entries"`
+	// 最後のイベントまで実行したか
+	Ended bool `json:"ended"`
+	// 総当たりで、以前に通った選択待ちに戻ったので打ち切ったか
+	Revisited bool `json:"revisited"`
+}
+
+// 差分を確認しやすいテキストにする
+//
+//	*ラベル
+//	! 通知
+//	| 本文
+//	? 番号: 選択肢 -> 遷移先
+//	- イベント
+func (t *Transcript) String() string {
+	var out strings.Builder
+	for _, e := range t.Entries {
+		switch e.Kind {
+		case EntryLabel:
+			fmt.Fprintf(&out, "*%s\n", e.Text)
+		case EntryPage:
+			for _, line := range strings.Split(e.Text, "\n") {
+				fmt.Fprintf(&out, "| %s\n", line)
+			}
+			out.WriteString("\n")
+		case EntryNotify:
+			fmt.Fprintf(&out, "! %s\n", e.Text)
+		case EntryChoice:
+			fmt.Fprintf(&out, "? %s\n", e.Text)
+		case EntryEvent:
+			fmt.Fprintf(&out, "- %s\n", e.Text)
+		}
+	}
+	switch {
+	case t.Ended:
+		out.WriteString("(おわり)\n")
+	case t.Revisited:
+		out.WriteString("(以前に通った選択肢に戻ったので打ち切り)\n")
+	}
+
+	return out.String()
+}
+
+// 複数のルートの記録を、ルートごとに見出しをつけて並べる
+func FormatRoutes(ts []*Transcript) string {
+	var out strings.Builder
+	for i, t := range ts {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "== ルート %v\n", t.Choices)
+		out.WriteString(t.String())
+	}
+
+	return out.String()
+}
+
+// シナリオを画面なしで実行する
+type Runner struct {
+	Evaluator *event.Evaluator
+	// クリック待ちになるまで待つ時間の上限。超えたら止まったとみなす
+	Timeout time.Duration
+	// 1ルートあたりのクリック待ちの回数の上限
+	MaxPages int
+	// 総当たりで試すルート数の上限
+	MaxRoutes int
+	// 本文と通知に加えて、実行したすべてのイベントを記録する
+	RecordEvents bool
+	// 指定すると、すべてのルートで実行したラベルとイベントを記録する
+	Coverage *event.Coverage
+}
+
+func NewRunner(e *event.Evaluator) *Runner {
+	return &Runner{
+		Evaluator: e,
+		Timeout:   DefaultTimeout,
+		MaxPages:  DefaultMaxPages,
+		MaxRoutes: DefaultMaxRoutes,
+	}
+}
+
+// 選択肢をchoicesの順に選んで、最後まで実行する
+// choicesを使い切ったあとは最初の選択肢を選ぶ
+// エラーのときも、それまでの記録を返す
+func (r *Runner) Run(choices []int) (*Transcript, error) {
+	t, _, err := r.run(choices, false)
+
+	return t, err
+}
+
+// すべてのルートを実行する。ルートは選択肢の番号の辞書順に並べる
+// 以前に通った選択待ちへ戻ってきたルートは、そこで打ち切る。その先は別のルートで試している
+// エラーになったルートがあれば、ルートごとのエラーをまとめて返す
+func (r *Runner) Explore() ([]*Transcript, error) {
+	result := []*Transcript{}
+	errs := []error{}
+
+	stack := [][]int{{}}
+	for len(stack) > 0 {
+		if len(result) >= r.MaxRoutes {
+			errs = append(errs, fmt.Errorf("%w: %d", ErrTooManyRoutes, r.MaxRoutes))
+			break
+		}
+		prefix := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		t, counts, err := r.run(prefix, true)
+		result = append(result, t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ルート %v: %w", t.Choices, err))
+		}
+		// 深い選択肢の、番号の小さいものから試すように積む
+		for d := len(prefix); d < len(counts); d++ {
+			for k := counts[d] - 1; k >= 1; k-- {
+				next := append(append([]int{}, t.Choices[:d]...), k)
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// 1ルートを実行する。選んだ選択肢ごとに、選択肢の数を返す
+// exploreのときは、以前に通った選択待ちに戻ったところで打ち切る
+func (r *Runner) run(choices []int, explore bool) (*Transcript, []int, error) {
+	t := &Transcript{Choices: []int{}, Labels: []string{}, Entries: []Entry{}}
+	if _, err := r.Evaluator.Compile(StartLabel); err != nil {
+		return t, nil, err
+	}
+
+	p := &play{
+		runner: r,
+		t:      t,
+		q:      event.NewQueue(r.Evaluator),
+		fail:   make(chan error, 1),
+		since:  []string{},
+	}
+	config := p.q.Config()
+	config.Instant = true
+	config.SkipWait = true
+	config.AutoAdvance = 0
+	p.q.SetConfig(config)
+	p.q.Hooks.OnPlay = p.onPlay
+	p.q.Hooks.OnEvent = p.onEvent
+	p.q.Coverage = r.Coverage
+
+	quit := make(chan struct{})
+	defer close(quit)
+	defer p.q.Stop()
+	// 通知はフックで記録するので、詰まらないように読み捨てる
+	go func() {
+		for {
+			select {
+			case <-p.q.NotifyChan:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	counts := []int{}
+	visited := map[string]bool{}
+	p.q.Start()
+	for pages := 0; ; pages++ {
+		if pages >= r.MaxPages {
+			return t, counts, fmt.Errorf("%w: %d", ErrTooLong, r.MaxPages)
+		}
+		if err := p.wait(); err != nil {
+			return t, counts, err
+		}
+		if p.q.Ended() {
+			p.page()
+			t.Ended = true
+			return t, counts, nil
+		}
+
+		switch p.q.Head().(type) {
+		case *event.Flush:
+			p.page()
+			p.q.Run()
+			p.printed = 0
+		case *event.Select:
+			p.page()
+			where := p.where()
+			// 総当たりではすべての選択待ちを、指定の順に選ぶときは指定を使い切ったあとの選択待ちを覚えておく
+			// 指定を使い切ったあとは常に最初の選択肢を選ぶので、同じ選択待ちに戻ったら抜け出せない
+			if explore || len(t.Choices) >= len(choices) {
+				if visited[where] {
+					if explore {
+						t.Revisited = true
+						return t, counts, nil
+					}
+					return t, counts, fmt.Errorf("%w: 選択肢の指定を使い切ったあと、同じ選択待ちに戻った: %s", ErrLoop, where)
+				}
+				visited[where] = true
+			}
+
+			options := p.q.Choices()
+			if len(options) == 0 {
+				return t, counts, fmt.Errorf("%s: 選択肢がないまま選択待ちになった", where)
+			}
+			i := 0
+			if len(t.Choices) < len(choices) {
+				i = choices[len(t.Choices)]
+			}
+			if i < 0 || i >= len(options) {
+				return t, counts, fmt.Errorf("%s: 選択肢の範囲外: %d (選択肢は%d個)", where, i, len(options))
+			}
+			counts = append(counts, len(options))
+			t.Choices = append(t.Choices, i)
+			p.add(EntryChoice, fmt.Sprintf("%d: %s -> %s", i, options[i].Text, options[i].Target))
+
+			p.mu.Lock()
+			p.since = []string{}
+			p.mu.Unlock()
+			if err := p.q.Choose(i); err != nil {
+				return t, counts, fmt.Errorf("%s: %w", where, err)
+			}
+		default:
+			p.q.Run()
+		}
+	}
+}
+
+// 1ルートの実行中の状態
+type play struct {
+	runner *Runner
+	t      *Transcript
+	q      *event.Queue
+	// ワーカー側で検出したエラー
+	fail chan error
+	// 表示中の文字列のうち、記録済みのバイト数
+	printed int
+
+	// フックはワーカーのゴルーチンから呼ばれるので、記録を保護する
+	mu sync.Mutex
+	// 直前の選択以降に再生したラベル
+	since []string
+}
+
+func (p *play) add(kind EntryKind, text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.t.Entries = append(p.t.Entries, Entry{Kind: kind, Text: text})
+	if kind == EntryLabel {
+		p.t.Labels = append(p.t.Labels, text)
+	}
+}
+
+// 選択を挟まずに同じラベルを再生したら、以降は同じ流れを繰り返すだけなので止める
+func (p *play) onPlay(label string) {
+	p.add(EntryLabel, label)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, l := range p.since {
+		if l == label {
+			loop := append(append([]string{}, p.since[i:]...), label)
+			p.q.Stop()
+			select {
+			case p.fail <- fmt.Errorf("%w: %s", ErrLoop, strings.Join(loop, " -> ")):
+			default:
+			}
+			return
+		}
+	}
+	p.since = append(p.since, label)
+}
+
+func (p *play) onEvent(e event.Event) {
+	if _, ok := e.(event.Notifier); ok {
+		p.add(EntryNotify, e.String())
+	} else if p.runner.RecordEvents {
+		p.add(EntryEvent, e.String())
+	}
+}
+
+// 表示中の文字列のうち、まだ記録していない部分を記録する
+func (p *play) page() {
+	display := p.q.Display()
+	if p.printed > len(display) {
+		p.printed = 0
+	}
+	text := strings.Trim(display[p.printed:], "\n")
+	p.printed = len(display)
+	if text == "" {
+		return
+	}
+	p.add(EntryPage, text)
+}
+
+// クリック待ちか終了まで待つ
+// 待機するゴルーチンは、クリック待ちになるか、runの最後でキューをStop()すると終わる
+func (p *play) wait() error {
+	done := make(chan struct{})
+	go func() {
+		p.q.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		select {
+		case err := <-p.fail:
+			return err
+		default:
+			return nil
+		}
+	case err := <-p.fail:
+		return err
+	case <-time.After(p.runner.Timeout):
+		p.q.Stop()
+		return fmt.Errorf("%w: %s", ErrStuck, p.where())
+	}
+}
+
+// 実行中イベントの位置を返す
+func (p *play) where() string {
+	label, index := p.q.Location()
+	c, err := p.runner.Evaluator.Compile(label)
+	if err != nil || index >= len(c.Positions) {
+		return label
+	}
+
+	return fmt.Sprintf("%s %s", label, c.Positions[index])
+}
@@ -0,0 +1,162 @@
+package headless
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `*start
+[image source="room.png"]
+目が覚めた。[l]
+どこへ行こう？[p]
+[choice text="外へ" target="outside"]
+[choice text="寝る" target="sleep"]
+[select]
+*outside
+[image source="sky.png"]
+空が青い。[p]
+[jump target="ending"]
+*sleep
+もう一度？[l]
+[choice text="寝る" target="sleep"]
+[choice text="起きる" target="ending"]
+[select]
+*ending
+おわり[p]`
+
+func newRunner(t *testing.T, input string) *Runner {
+	t.Helper()
+
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+
+	return NewRunner(e)
+}
+
+func TestRun_指定した選択肢で最後まで進める(t *testing.T) {
+	r := newRunner(t, input)
+	tr, err := r.Run([]int{1, 1})
+	assert.NoError(t, err)
+
+	assert.True(t, tr.Ended)
+	assert.Equal(t, []int{1, 1}, tr.Choices)
+	assert.Equal(t, []string{"start", "sleep", "ending"}, tr.Labels)
+	assert.Equal(t, `*start
+! <ChangeBg room.png>
+| 目が覚めた。
+| どこへ行こう？
+
+? 1: 寝る -> sleep
+*sleep
+| もう一度？
+
+? 1: 起きる -> ending
+*ending
+| おわり
+
+(おわり)
+`, tr.String())
+}
+
+func TestRun_指定を使い切ったら最初の選択肢を選ぶ(t *testing.T) {
+	r := newRunner(t, input)
+	tr, err := r.Run(nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{0}, tr.Choices)
+	assert.Equal(t, []string{"start", "outside", "ending"}, tr.Labels)
+}
+
+func TestRun_選択肢でも抜け出せないループを報告する(t *testing.T) {
+	r := newRunner(t, input)
+	tr, err := r.Run([]int{1})
+
+	assert.True(t, errors.Is(err, ErrLoop))
+	assert.False(t, tr.Ended)
+	assert.Equal(t, []int{1, 0}, tr.Choices)
+}
+
+func TestRun_範囲外の選択肢はエラーになる(t *testing.T) {
+	r := newRunner(t, input)
+	_, err := r.Run([]int{2})
+
+	assert.EqualError(t, err, "start 7:1: 選択肢の範囲外: 2 (選択肢は2個)")
+}
+
+func TestRun_ジャンプだけのループを報告する(t *testing.T) {
+	r := newRunner(t, `*start
+[jump target="a"]
+*a
+ループ[p]
+[jump target="b"]
+*b
+[jump target="a"]`)
+	tr, err := r.Run(nil)
+
+	assert.EqualError(t, err, "無限ループ: a -> b -> a")
+	assert.Equal(t, []string{"start", "a", "b", "a"}, tr.Labels)
+}
+
+func TestRun_エラーで終わってもゴルーチンを残さない(t *testing.T) {
+	before := runtime.NumGoroutine()
+	r := newRunner(t, `*start
+[jump target="start"]`)
+	_, err := r.Run(nil)
+	assert.Error(t, err)
+
+	// assert.Eventuallyは確認用のゴルーチンを作るので、自分で待つ
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestRun_選択肢がない選択待ちはエラーになる(t *testing.T) {
+	r := newRunner(t, `*start
+[select]`)
+	_, err := r.Run(nil)
+
+	assert.EqualError(t, err, "start 2:1: 選択肢がないまま選択待ちになった")
+}
+
+func TestRun_startラベルがないとエラーになる(t *testing.T) {
+	r := newRunner(t, `*other
+あ[p]`)
+	_, err := r.Run(nil)
+
+	assert.Error(t, err)
+}
+
+func TestExplore_すべてのルートを実行する(t *testing.T) {
+	r := newRunner(t, input)
+	routes, err := r.Explore()
+	assert.NoError(t, err)
+
+	choices := [][]int{}
+	for _, tr := range routes {
+		choices = append(choices, tr.Choices)
+	}
+	assert.Equal(t, [][]int{{0}, {1, 0}, {1, 1}}, choices)
+	assert.True(t, routes[0].Ended)
+	assert.True(t, routes[1].Revisited)
+	assert.True(t, routes[2].Ended)
+}
+
+func TestExplore_ルート数の上限を超えるとエラーになる(t *testing.T) {
+	r := newRunner(t, input)
+	r.MaxRoutes = 2
+	routes, err := r.Explore()
+
+	assert.True(t, errors.Is(err, ErrTooManyRoutes))
+	assert.Equal(t, 2, len(routes))
+}
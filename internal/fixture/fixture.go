@@ -0,0 +1,23 @@
+// テストやベンチマークで使うシナリオを生成するパッケージ
+package fixture
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ラベルがlabels個ある、大きなシナリオを生成する
+// 各ラベルは本文、ルビ、装飾、クリック待ちを100回ずつ含み、次のラベルへジャンプする
+func LargeScenario(labels int) string {
+	var b strings.Builder
+	for i := 0; i < labels; i++ {
+		fmt.Fprintf(&b, "*ch%d\n; 第%d章\n", i, i)
+		for j := 0; j < 100; j++ {
+			b.WriteString("吾輩は猫である。[ruby text=\"な\"]名[endruby]前はまだ無い。[l]\n")
+			b.WriteString("[font color=\"#ff0000\" size=30]どこで生れたか[resetfont]とんと見当がつかぬ。[p]\n")
+		}
+		fmt.Fprintf(&b, "[jump target=ch%d]\n", i+1)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,482 @@
+// ASTとコンパイル済みのイベント列をJSONで読み書きするパッケージ
+// 翻訳ツールやエディタなど、外部のツールとシナリオをやりとりするのに使う
+// 形式はバージョンを持ち、Goの型の変更に影響されないように項目を明示的に定義している
+package jsonenc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/token"
+	"github.com/kijimaD/nova/utils"
+)
+
+// 形式のバージョン。互換性のない変更をしたら上げる
+// 2: 選択肢のイベントを追加
+const Version = 2
+
+// バージョンが一致しない
+var ErrIncompatibleVersion = errors.New("JSONのバージョンに対応していない")
+
+// ソース上の位置
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+func newPosition(pos token.Position) Position {
+	return Position{Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+}
+
+func (p Position) token() token.Position {
+	return token.Position{Line: p.Line, Column: p.Column, Offset: p.Offset}
+}
+
+// ================
+
+// ASTの文書
+type ProgramDocument struct {
+	Version    int       `json:"version"`
+	Statements []Node    `json:"statements"`
+	Comments   []Comment `json:"comments,omitempty"`
+}
+
+// 文
+// Typeによって使う項目が異なる
+//
+//	label   Name Body
+//	text    Text
+//	cmd     Name Params
+//	newline なし
+type Node struct {
+	Type     string    `json:"type"`
+	Pos      Position  `json:"pos"`
+	Comments []Comment `json:"comments,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Text     string    `json:"text,omitempty"`
+	Params   []Param   `json:"params,omitempty"`
+	Body     []Node    `json:"body,omitempty"`
+}
+
+const (
+	nodeLabel   = "label"
+	nodeText    = "text"
+	nodeCmd     = "cmd"
+	nodeNewline = "newline"
+)
+
+// コマンドのパラメータ。値は型に関係なく、書かれたとおりの文字列で持つ
+type Param struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"` // string int float ident
+	Value string `json:"value"`
+}
+
+var paramTypes = map[string]token.TokenType{
+	"string": token.STRING,
+	"int":    token.INT,
+	"float":  token.FLOAT,
+	"ident":  token.IDENT,
+}
+
+// コメント
+type Comment struct {
+	Pos     Position `json:"pos"`
+	Literal string   `json:"literal"` // 記号を含む、書かれたとおりの文字列
+	Text    string   `json:"text"`    // 記号を除いた内容
+}
+
+// ASTを書き込む
+func EncodeProgram(w io.Writer, program *ast.Program) error {
+	doc := ProgramDocument{Version: Version, Statements: []Node{}}
+	for _, stmt := range program.Statements {
+		n, err := newNode(stmt)
+		if err != nil {
+			return err
+		}
+		doc.Statements = append(doc.Statements, n)
+	}
+	doc.Comments = newComments(program.Comments)
+
+	return encode(w, doc)
+}
+
+// ASTを読み込む
+func DecodeProgram(r io.Reader) (*ast.Program, error) {
+	var doc ProgramDocument
+	if err := decode(r, &doc, &doc.Version, Version); err != nil {
+		return nil, err
+	}
+
+	program := &ast.Program{Statements: []ast.Statement{}}
+	for _, n := range doc.Statements {
+		stmt, err := n.statement()
+		if err != nil {
+			return nil, err
+		}
+		program.Statements = append(program.Statements, stmt)
+	}
+	program.Comments = commentsAST(doc.Comments)
+
+	return program, nil
+}
+
+func newNode(stmt ast.Statement) (Node, error) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return Node{}, fmt.Errorf("JSONに変換できない文: %T", stmt)
+	}
+	n := Node{Pos: newPosition(es.Token.Pos), Comments: newComments(es.Comments)}
+	switch e := es.Expression.(type) {
+	case nil:
+		n.Type = nodeNewline
+	case *ast.TextLiteral:
+		n.Type = nodeText
+		n.Text = e.Value
+	case *ast.CmdLiteral:
+		n.Type = nodeCmd
+		n.Name = e.FuncName.Value
+		n.Params = newParams(e.Parameters)
+	case *ast.LabelLiteral:
+		n.Type = nodeLabel
+		n.Name = e.LabelName.Value
+		n.Body = []Node{}
+		for _, s := range e.Body.Statements {
+			child, err := newNode(s)
+			if err != nil {
+				return Node{}, err
+			}
+			n.Body = append(n.Body, child)
+		}
+	default:
+		return Node{}, fmt.Errorf("JSONに変換できない式: %T", e)
+	}
+
+	return n, nil
+}
+
+// パラメータを名前順に並べる
+func newParams(params ast.NamedParams) []Param {
+	keys := []string{}
+	for k := range params.Map {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []Param{}
+	for _, k := range keys {
+		p := Param{Name: k, Value: params.Get(k)}
+		switch params.Map[k].(type) {
+		case *ast.StringLiteral:
+			p.Type = "string"
+		case *ast.IntegerLiteral:
+			p.Type = "int"
+		case *ast.FloatLiteral:
+			p.Type = "float"
+		default:
+			p.Type = "ident"
+		}
+		result = append(result, p)
+	}
+
+	return result
+}
+
+func newComments(comments []*ast.Comment) []Comment {
+	result := []Comment{}
+	for _, c := range comments {
+		result = append(result, Comment{Pos: newPosition(c.Token.Pos), Literal: c.Token.Literal, Text: c.Text})
+	}
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+func commentsAST(comments []Comment) []*ast.Comment {
+	var result []*ast.Comment
+	for _, c := range comments {
+		result = append(result, &ast.Comment{
+			Token: token.Token{Type: token.COMMENT, Literal: c.Literal, Pos: c.Pos.token()},
+			Text:  c.Text,
+		})
+	}
+
+	return result
+}
+
+// 構文解析器が生成するのと同じ形のASTに戻す
+func (n Node) statement() (*ast.ExpressionStatement, error) {
+	pos := n.Pos.token()
+	stmt := &ast.ExpressionStatement{Comments: commentsAST(n.Comments)}
+	switch n.Type {
+	case nodeNewline:
+		stmt.Token = token.Token{Type: token.NEWLINE, Literal: token.NEWLINE, Pos: pos}
+	case nodeText:
+		stmt.Token = token.Token{Type: token.TEXT, Literal: n.Text, Pos: pos}
+		stmt.Expression = &ast.TextLiteral{Token: stmt.Token, Value: n.Text}
+	case nodeCmd:
+		stmt.Token = token.Token{Type: token.LBRACKET, Literal: token.LBRACKET, Pos: pos}
+		params, err := paramsAST(n.Params)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Expression = &ast.CmdLiteral{
+			Token:      stmt.Token,
+			FuncName:   ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: n.Name}, Value: n.Name},
+			Parameters: params,
+		}
+	case nodeLabel:
+		stmt.Token = token.Token{Type: token.ASTERISK, Literal: token.ASTERISK, Pos: pos}
+		body := &ast.BlockStatement{Statements: []ast.Statement{}}
+		for _, child := range n.Body {
+			s, err := child.statement()
+			if err != nil {
+				return nil, err
+			}
+			body.Statements = append(body.Statements, s)
+		}
+		if len(body.Statements) > 0 {
+			body.Token = body.Statements[0].(*ast.ExpressionStatement).Token
+		}
+		stmt.Expression = &ast.LabelLiteral{
+			Token:     stmt.Token,
+			LabelName: ast.Identifier{Token: token.Token{Type: token.TEXT, Literal: n.Name}, Value: n.Name},
+			Body:      body,
+		}
+	default:
+		return nil, fmt.Errorf("不明な文の種類: %s", n.Type)
+	}
+
+	return stmt, nil
+}
+
+func paramsAST(params []Param) (ast.NamedParams, error) {
+	result := ast.NamedParams{Map: map[string]ast.Expression{}}
+	for _, p := range params {
+		t, ok := paramTypes[p.Type]
+		if !ok {
+			return result, fmt.Errorf("不明なパラメータの型: %s", p.Type)
+		}
+		tok := token.Token{Type: t, Literal: p.Value}
+		var v ast.Expression
+		switch t {
+		case token.STRING:
+			v = &ast.StringLiteral{Token: tok, Value: p.Value}
+		case token.INT:
+			i, err := strconv.ParseInt(p.Value, 10, 64)
+			if err != nil {
+				return result, fmt.Errorf("整数として解釈できない: %s", p.Value)
+			}
+			v = &ast.IntegerLiteral{Token: tok, Value: i}
+		case token.FLOAT:
+			f, err := strconv.ParseFloat(p.Value, 64)
+			if err != nil {
+				return result, fmt.Errorf("小数として解釈できない: %s", p.Value)
+			}
+			v = &ast.FloatLiteral{Token: tok, Value: f}
+		case token.IDENT:
+			v = &ast.Identifier{Token: tok, Value: p.Value}
+		}
+		result.Map[p.Name] = v
+	}
+
+	return result, nil
+}
+
+// ================
+
+// コンパイル済みイベント列の文書
+type LabelsDocument struct {
+	Version int     `json:"version"`
+	Labels  []Label `json:"labels"`
+}
+
+// ラベルごとのイベント列
+type Label struct {
+	Name   string  `json:"name"`
+	Events []Event `json:"events"`
+}
+
+// イベント。TypeはイベントのString()と同じ名前で、Typeによって使う項目が異なる
+// 時間はミリ秒で表す
+type Event struct {
+	Type     string   `json:"type"`
+	Pos      Position `json:"pos"`
+	Body     string   `json:"body,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	Duration *int64   `json:"duration,omitempty"`
+	NoWait   bool     `json:"nowait,omitempty"`
+	Color    *string  `json:"color,omitempty"`
+	Size     *float64 `json:"size,omitempty"`
+	Bold     *bool    `json:"bold,omitempty"`
+	Italic   *bool    `json:"italic,omitempty"`
+	Emphasis *bool    `json:"emphasis,omitempty"`
+	Text     string   `json:"text,omitempty"`
+	Target   string   `json:"target,omitempty"`
+}
+
+// コンパイル済みのイベント列を書き込む
+func EncodeLabels(w io.Writer, labels []*event.CompiledLabel) error {
+	doc := LabelsDocument{Version: Version, Labels: []Label{}}
+	for _, label := range labels {
+		l := Label{Name: label.Name, Events: []Event{}}
+		for i, e := range label.Events {
+			j, err := newEvent(e)
+			if err != nil {
+				return err
+			}
+			j.Pos = newPosition(label.Positions[i])
+			l.Events = append(l.Events, j)
+		}
+		doc.Labels = append(doc.Labels, l)
+	}
+
+	return encode(w, doc)
+}
+
+// コンパイル済みのイベント列を読み込む
+// event.NewEvaluatorFromCompiledに渡すと、そのまま実行できる
+func DecodeLabels(r io.Reader) ([]*event.CompiledLabel, error) {
+	return decodeLabels(r, Version)
+}
+
+// バージョンがversionのファイルだけを読み込む
+func decodeLabels(r io.Reader, version int) ([]*event.CompiledLabel, error) {
+	var doc LabelsDocument
+	if err := decode(r, &doc, &doc.Version, version); err != nil {
+		return nil, err
+	}
+
+	result := []*event.CompiledLabel{}
+	for _, l := range doc.Labels {
+		label := &event.CompiledLabel{Name: l.Name, Events: []event.Event{}, Positions: []token.Position{}}
+		for _, j := range l.Events {
+			e, err := j.event()
+			if err != nil {
+				return nil, err
+			}
+			label.Events = append(label.Events, e)
+			label.Positions = append(label.Positions, j.Pos.token())
+		}
+		result = append(result, label)
+	}
+
+	return result, nil
+}
+
+func newEvent(e event.Event) (Event, error) {
+	switch e := e.(type) {
+	case *event.MsgEmit:
+		return Event{Type: "MsgEmit", Body: e.Body}, nil
+	case *event.Flush:
+		return Event{Type: "Flush"}, nil
+	case *event.LineEndWait:
+		return Event{Type: "LineEndWait"}, nil
+	case *event.ChangeBg:
+		return Event{Type: "ChangeBg", Source: e.Source}, nil
+	case *event.Wait:
+		return Event{Type: "Wait", Duration: msec(e.DurationMsec)}, nil
+	case *event.Delay:
+		if e.NoWait {
+			return Event{Type: "Delay", NoWait: true}, nil
+		}
+		return Event{Type: "Delay", Duration: msec(e.Speed)}, nil
+	case *event.Font:
+		return Event{Type: "Font", Color: e.Color, Size: e.Size, Bold: e.Bold, Italic: e.Italic, Emphasis: e.Emphasis}, nil
+	case *event.ResetFont:
+		return Event{Type: "ResetFont"}, nil
+	case *event.Ruby:
+		return Event{Type: "Ruby", Text: e.Text}, nil
+	case *event.EndRuby:
+		return Event{Type: "EndRuby"}, nil
+	case *event.Jump:
+		return Event{Type: "Jump", Target: e.Target}, nil
+	case *event.Newline:
+		return Event{Type: "Newline"}, nil
+	case *event.Choice:
+		return Event{Type: "Choice", Text: e.Text, Target: e.Target}, nil
+	case *event.Select:
+		return Event{Type: "Select"}, nil
+	}
+
+	return Event{}, fmt.Errorf("JSONに変換できないイベント: %s", e)
+}
+
+func (j Event) event() (event.Event, error) {
+	switch j.Type {
+	case "MsgEmit":
+		return &event.MsgEmit{Body: j.Body}, nil
+	case "Flush":
+		return &event.Flush{}, nil
+	case "LineEndWait":
+		return &event.LineEndWait{}, nil
+	case "ChangeBg":
+		return &event.ChangeBg{Source: j.Source}, nil
+	case "Wait":
+		return &event.Wait{DurationMsec: j.duration()}, nil
+	case "Delay":
+		return &event.Delay{Speed: j.duration(), NoWait: j.NoWait}, nil
+	case "Font":
+		return &event.Font{Color: j.Color, Size: j.Size, Bold: j.Bold, Italic: j.Italic, Emphasis: j.Emphasis}, nil
+	case "ResetFont":
+		return &event.ResetFont{}, nil
+	case "Ruby":
+		return &event.Ruby{Text: j.Text}, nil
+	case "EndRuby":
+		return &event.EndRuby{}, nil
+	case "Jump":
+		return &event.Jump{Target: j.Target}, nil
+	case "Newline":
+		return &event.Newline{}, nil
+	case "Choice":
+		return &event.Choice{Text: j.Text, Target: j.Target}, nil
+	case "Select":
+		return &event.Select{}, nil
+	}
+
+	return nil, fmt.Errorf("不明なイベントの種類: %s", j.Type)
+}
+
+func msec(d time.Duration) *int64 {
+	return utils.GetPtr(d.Milliseconds())
+}
+
+func (j Event) duration() time.Duration {
+	if j.Duration == nil {
+		return 0
+	}
+
+	return time.Duration(*j.Duration) * time.Millisecond
+}
+
+// ================
+
+func encode(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+// 読み込んで、バージョンがwantと一致するか確認する
+func decode(r io.Reader, v interface{}, version *int, want int) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return err
+	}
+	if *version != want {
+		return fmt.Errorf("%w: ファイルのバージョン %d, 対応するバージョン %d", ErrIncompatibleVersion, *version, want)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package jsonenc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/format"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const input = `; 冒頭のコメント
+*start
+こんにちは[l]世界[p]
+
+[image source="test.png"]
+[wait time=100]
+[delay speed=30][delay speed=nowait]
+[font color="#ff0000" size=1.5 bold=true italic=false][resetfont]
+[ruby text="かんじ"]漢字[endruby][r]
+[choice text="進む" target=第一章][select]
+[jump target=第一章]
+
+/* 第一章 */
+*第一章
+おわり[p]
+; 末尾のコメント
+`
+
+func TestEncodeProgram_読み込むと元に戻る(t *testing.T) {
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeProgram(&buf, program))
+	encoded := buf.String()
+	assert.Contains(t, encoded, `"version": 2`)
+
+	decoded, err := DecodeProgram(&buf)
+	assert.NoError(t, err)
+
+	// 整形した結果と、もう一度書き込んだ結果が変わらない
+	var expect, actual bytes.Buffer
+	assert.NoError(t, format.Fprint(&expect, program))
+	assert.NoError(t, format.Fprint(&actual, decoded))
+	assert.Equal(t, expect.String(), actual.String())
+
+	var again bytes.Buffer
+	assert.NoError(t, EncodeProgram(&again, decoded))
+	assert.Equal(t, encoded, again.String())
+}
+
+func TestEncodeProgram_パラメータの型と位置を持つ(t *testing.T) {
+	program, err := parser.NewParser(lexer.NewLexer(`*start
+  [font size=1.5 color=red bold="true"]`)).ParseProgram()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeProgram(&buf, program))
+	expect := `{
+  "version": 2,
+  "statements": [
+    {
+      "type": "label",
+      "pos": {
+        "line": 1,
+        "column": 1,
+        "offset": 0
+      },
+      "name": "start",
+      "body": [
+        {
+          "type": "cmd",
+          "pos": {
+            "line": 2,
+            "column": 3,
+            "offset": 9
+          },
+          "name": "font",
+          "params": [
+            {
+              "name": "bold",
+              "type": "string",
+              "value": "true"
+            },
+            {
+              "name": "color",
+              "type": "ident",
+              "value": "red"
+            },
+            {
+              "name": "size",
+              "type": "float",
+              "value": "1.5"
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`
+	assert.Equal(t, expect, buf.String())
+}
+
+func TestEncodeLabels_読み込むと実行できる(t *testing.T) {
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	labels, err := e.CompileAll()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeLabels(&buf, labels))
+	assert.Contains(t, buf.String(), `"type": "Wait"`)
+	assert.Contains(t, buf.String(), `"duration": 100`)
+
+	decoded, err := DecodeLabels(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, labels, decoded)
+
+	q := event.NewQueue(event.NewEvaluatorFromCompiled(decoded))
+	assert.NoError(t, q.Play("第一章"))
+	assert.Equal(t, []string{"<MsgEmit おわり>", "<Flush>"}, q.DumpQueue())
+}
+
+func TestDecode_バージョンが異なるとエラーを返す(t *testing.T) {
+	{
+		_, err := DecodeProgram(strings.NewReader(`{"version": 99, "statements": []}`))
+		assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	}
+	{
+		_, err := DecodeLabels(strings.NewReader(`{"labels": []}`))
+		assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	}
+	{
+		_, err := DecodeLabels(strings.NewReader(`{"version": 2, "labels": [{"name": "start", "events": [{"type": "Unknown"}]}]}`))
+		assert.ErrorContains(t, err, "不明なイベントの種類: Unknown")
+	}
+}
+
+func TestDecodeLabels_古い形式の読み込み側はバージョンで拒否する(t *testing.T) {
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	labels, err := e.CompileAll()
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeLabels(&buf, labels))
+
+	// 選択肢を知らないバージョン1の読み込み側は、不明なイベントではなくバージョンの違いとして報告する
+	_, err = decodeLabels(&buf, 1)
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	assert.ErrorContains(t, err, "ファイルのバージョン 2, 対応するバージョン 1")
+}
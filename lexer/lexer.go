@@ -1,39 +1,128 @@
 package lexer
 
 import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/kijimaD/nova/token"
 )
 
+// 本文中でエスケープできる記号
+const textEscapes = `[]\;/`
+
+// 字句解析器
+// 入力を少しずつ読み込むので、大きなシナリオでも全体をメモリに載せずに処理できる
 type Lexer struct {
-	input        string
-	position     int // 現在検査中のバイトchの位置
-	readPosition int // 入力における次の位置
-	ch           byte
-	OnIdent      bool
+	r            *bufio.Reader
+	err          error // 読み込み中に発生したエラー。io.EOFは含まない
+	position     int   // 現在検査中の文字chの位置
+	readPosition int   // 入力における次の位置
+	ch           rune  // 現在検査中の文字。UTF-8としてデコードしたもの
+	// chがUTF-8として不正なバイトか。不正なときは元のバイトをrawに持つ
+	invalid bool
+	raw     byte
+	line    int // chの行番号
+	column  int // chの列番号
+	OnIdent bool
+	// 行頭にいるか。コメントは行頭でだけ認識する
+	lineStart bool
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewLexerFromReader(strings.NewReader(input))
+}
+
+// 入力を読み込みながら字句解析する
+func NewLexerFromReader(r io.Reader) *Lexer {
+	l := &Lexer{r: bufio.NewReader(r), lineStart: true, line: 1}
 	l.readChar()
 	return l
 }
 
+// 読み込み中に発生したエラーを返す
+// エラーが発生したときは、そこで入力が終わったものとしてEOFを返している
+func (l *Lexer) Err() error {
+	return l.err
+}
+
 // 次の1文字を読んでinput文字列の現在位置を進める
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0 // ASCIIコードの"NUL"文字に対応している
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
 	}
+	l.column++
+
 	l.position = l.readPosition
-	l.readPosition += 1
+	r, size, err := l.r.ReadRune()
+	if err != nil {
+		if err != io.EOF && l.err == nil {
+			l.err = err
+		}
+		l.ch = 0 // ASCIIコードの"NUL"文字に対応している
+		l.invalid = false
+		return
+	}
+	l.ch = r
+	l.invalid = r == utf8.RuneError && size == 1
+	if l.invalid {
+		// 元のバイトを読み直す
+		_ = l.r.UnreadRune()
+		l.raw, _ = l.r.ReadByte()
+	}
+	l.readPosition += size
+}
+
+// 現在の文字を書き込む。不正なバイトはそのまま書き込む
+func (l *Lexer) writeChar(out *strings.Builder) {
+	if l.invalid {
+		out.WriteByte(l.raw)
+		return
+	}
+	out.WriteRune(l.ch)
+}
+
+// 現在の文字の位置を返す
+func (l *Lexer) pos() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
 }
 
 // 現在の1文字を読みこんでトークンを返す
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	tok := l.nextToken()
+	// コメントは末尾の改行まで読み込んだかどうかで、自身で設定する
+	if tok.Type != token.COMMENT {
+		l.lineStart = tok.Type == token.NEWLINE
+	}
+
+	return tok
+}
 
+func (l *Lexer) nextToken() token.Token {
 	l.skipWhitespace()
+	pos := l.pos()
+	tok := l.readToken()
+	tok.Pos = pos
+
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
+	// UTF-8として不正なバイトは1バイトずつ不正なトークンにする
+	if l.invalid {
+		tok = token.Token{Type: token.ILLEGAL, Literal: string([]byte{l.raw})}
+		l.readChar()
+		return tok
+	}
+
+	if l.lineStart && (l.ch == ';' || l.ch == '/' && l.peekChar() == '*') {
+		return l.readComment()
+	}
 
 	switch l.ch {
 	case '[':
@@ -43,10 +132,21 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, l.ch)
 		l.OnIdent = false
 	case '=':
+		// コマンドの外では本文として扱う
+		if !l.OnIdent {
+			return l.readTextToken()
+		}
 		tok = newToken(token.EQUAL, l.ch)
-	case '"':
+	case '"', '\'':
+		if !l.OnIdent {
+			return l.readTextToken()
+		}
+		literal, ok := l.readString(l.ch)
+		if !ok {
+			return token.Token{Type: token.ILLEGAL, Literal: literal}
+		}
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = literal
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '\n':
@@ -55,14 +155,18 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if l.OnIdent {
+		if !l.OnIdent {
+			return l.readTextToken()
+		}
+		switch {
+		case isLetter(l.ch):
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal) // 予約語
 			return tok
-		} else {
-			tok.Literal = l.readText()
-			tok.Type = token.TEXT
-			return tok
+		case isDigit(l.ch) || l.ch == '-' && isDigit(l.peekChar()):
+			return l.readNumber()
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
@@ -71,17 +175,18 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 // トークンを初期化する
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 // 予約語を読み込み
 func (l *Lexer) readIdentifier() string {
-	position := l.position
-	for isLetter(l.ch) {
+	var out strings.Builder
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
+		out.WriteRune(l.ch)
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return out.String()
 }
 
 // 半角スペースを読み飛ばす
@@ -92,37 +197,123 @@ func (l *Lexer) skipWhitespace() {
 }
 
 // のぞき見(peek)。readChar()の、文字解析器を進めないバージョン。先読みだけを行う
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	buf, _ := l.r.Peek(utf8.UTFMax)
+	if len(buf) == 0 {
 		return 0
-	} else {
-		return l.input[l.readPosition] // 次の位置を返す
 	}
+	r, _ := utf8.DecodeRune(buf) // 次の位置を返す
+	return r
+}
+
+func (l *Lexer) readTextToken() token.Token {
+	return token.Token{Type: token.TEXT, Literal: l.readText()}
 }
 
+// 本文を読み込む
+// \[ \] \\ \; \/ はエスケープして、記号そのものとして扱う
 func (l *Lexer) readText() string {
-	position := l.position
+	var out strings.Builder
+	for l.ch != '[' && l.ch != ']' && l.ch != 0 && l.ch != '\n' && !l.invalid {
+		if l.ch == '\\' && strings.ContainsRune(textEscapes, l.peekChar()) {
+			l.readChar()
+		}
+		out.WriteRune(l.ch)
+		l.readChar()
+	}
+	return out.String()
+}
+
+// 文字列を読み込む。quoteで囲まれた範囲を、エスケープを解釈して返す
+// 閉じられていなければfalseを返す
+func (l *Lexer) readString(quote rune) (string, bool) {
+	var out strings.Builder
 	for {
 		l.readChar()
-		if l.ch == '[' || l.ch == ']' || l.ch == 0 || l.ch == '\n' {
-			break
+		switch l.ch {
+		case quote:
+			return out.String(), true
+		case 0:
+			return out.String(), false
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteRune('\n')
+			case 't':
+				out.WriteRune('\t')
+			case 0:
+				return out.String(), false
+			default:
+				l.writeChar(&out)
+			}
+		default:
+			l.writeChar(&out)
 		}
 	}
-	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
+// 数値を読み込む。小数点を含むときはFLOATとする
+func (l *Lexer) readNumber() token.Token {
+	var out strings.Builder
+	tokenType := token.TokenType(token.INT)
+	if l.ch == '-' {
+		out.WriteRune(l.ch)
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+	}
+	for isDigit(l.ch) || l.ch == '.' && tokenType == token.INT && isDigit(l.peekChar()) {
+		if l.ch == '.' {
+			tokenType = token.FLOAT
 		}
+		out.WriteRune(l.ch)
+		l.readChar()
 	}
-	return l.input[position:l.position]
+	return token.Token{Type: tokenType, Literal: out.String()}
+}
+
+// コメントを読み込む
+// ;から行末までを行コメント、/*から*/までをブロックコメントとする
+// コメントに続く改行も読み込んで、行ごと取り除けるようにする
+func (l *Lexer) readComment() token.Token {
+	var out strings.Builder
+	if l.ch == ';' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.writeChar(&out)
+			l.readChar()
+		}
+	} else {
+		// 開き記号を読み飛ばしてから、閉じ記号を探す
+		out.WriteString("/*")
+		l.readChar()
+		l.readChar()
+		for !(l.ch == '*' && l.peekChar() == '/') {
+			if l.ch == 0 {
+				return token.Token{Type: token.ILLEGAL, Literal: out.String()}
+			}
+			l.writeChar(&out)
+			l.readChar()
+		}
+		out.WriteString("*/")
+		l.readChar()
+		l.readChar()
+	}
+	tok := token.Token{Type: token.COMMENT, Literal: strings.TrimRight(out.String(), "\r")}
+
+	l.lineStart = false
+	if l.ch == '\n' {
+		l.readChar()
+		l.lineStart = true
+	}
+
+	return tok
+}
+
+// 数字か判定する。数値リテラルに使うので、半角数字だけを対象にする
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
 }
 
-// 英字か判定する
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// 識別子に使える文字か判定する。日本語の名前も使えるようにする
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
@@ -1,8 +1,13 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/kijimaD/nova/internal/fixture"
 	"github.com/kijimaD/nova/token"
 
 	"github.com/stretchr/testify/assert"
@@ -214,3 +219,281 @@ func TestNextToken_ラベルを処理できる(t *testing.T) {
 		assert.Equal(t, tt.expectedLiteral, tok.Literal)
 	}
 }
+
+func TestNextToken_コメントを処理できる(t *testing.T) {
+	input := `; 行コメント
+あ;いう
+  ;インデントした行コメント
+/* ブロック
+コメント */
+[p]
+/* 閉じていない`
+	l := NewLexer(input)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{
+			expectedType:    token.COMMENT,
+			expectedLiteral: "; 行コメント",
+		},
+		{
+			expectedType:    token.TEXT,
+			expectedLiteral: "あ;いう",
+		},
+		{
+			expectedType:    token.NEWLINE,
+			expectedLiteral: "\n",
+		},
+		{
+			expectedType:    token.COMMENT,
+			expectedLiteral: ";インデントした行コメント",
+		},
+		{
+			expectedType:    token.COMMENT,
+			expectedLiteral: "/* ブロック\nコメント */",
+		},
+		{
+			expectedType:    token.LBRACKET,
+			expectedLiteral: "[",
+		},
+		{
+			expectedType:    token.IDENT,
+			expectedLiteral: "p",
+		},
+		{
+			expectedType:    token.RBRACKET,
+			expectedLiteral: "]",
+		},
+		{
+			expectedType:    token.NEWLINE,
+			expectedLiteral: "\n",
+		},
+		{
+			expectedType:    token.ILLEGAL,
+			expectedLiteral: "/* 閉じていない",
+		},
+		{
+			expectedType:    token.EOF,
+			expectedLiteral: "",
+		},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestNextToken_パラメータの値を処理できる(t *testing.T) {
+	input := `[wait time=500 size=-1.5 target=ch1 a='single' b="esc\"ape\\\n" c='it\'s']`
+	l := NewLexer(input)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.IDENT, "wait"},
+		{token.IDENT, "time"},
+		{token.EQUAL, "="},
+		{token.INT, "500"},
+		{token.IDENT, "size"},
+		{token.EQUAL, "="},
+		{token.FLOAT, "-1.5"},
+		{token.IDENT, "target"},
+		{token.EQUAL, "="},
+		{token.IDENT, "ch1"},
+		{token.IDENT, "a"},
+		{token.EQUAL, "="},
+		{token.STRING, "single"},
+		{token.IDENT, "b"},
+		{token.EQUAL, "="},
+		{token.STRING, "esc\"ape\\\n"},
+		{token.IDENT, "c"},
+		{token.EQUAL, "="},
+		{token.STRING, "it's"},
+		{token.RBRACKET, "]"},
+		{token.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestNextToken_本文の記号を処理できる(t *testing.T) {
+	input := `"引用"=\[括弧\]\\[p]
+\;コメントではない
+[image source="閉じていない`
+	l := NewLexer(input)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEXT, `"引用"=[括弧]\`},
+		{token.LBRACKET, "["},
+		{token.IDENT, "p"},
+		{token.RBRACKET, "]"},
+		{token.NEWLINE, "\n"},
+		{token.TEXT, ";コメントではない"},
+		{token.NEWLINE, "\n"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "image"},
+		{token.IDENT, "source"},
+		{token.EQUAL, "="},
+		{token.ILLEGAL, "閉じていない"},
+		{token.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestNextToken_日本語の識別子を処理できる(t *testing.T) {
+	input := `*第一章
+[ジャンプ 先=第二章 番号=2]`
+	l := NewLexer(input)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.ASTERISK, "*"},
+		{token.TEXT, "第一章"},
+		{token.NEWLINE, "\n"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "ジャンプ"},
+		{token.IDENT, "先"},
+		{token.EQUAL, "="},
+		{token.IDENT, "第二章"},
+		{token.IDENT, "番号"},
+		{token.EQUAL, "="},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.EOF, ""},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+	}
+}
+
+func TestNextToken_位置を記録する(t *testing.T) {
+	input := `*開始
+あいう[p]
+  [jump target=ch1]`
+	l := NewLexer(input)
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"*", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{"開始", token.Position{Offset: 1, Line: 1, Column: 2}},
+		{"\n", token.Position{Offset: 7, Line: 1, Column: 4}},
+		{"あいう", token.Position{Offset: 8, Line: 2, Column: 1}},
+		{"[", token.Position{Offset: 17, Line: 2, Column: 4}},
+		{"p", token.Position{Offset: 18, Line: 2, Column: 5}},
+		{"]", token.Position{Offset: 19, Line: 2, Column: 6}},
+		{"\n", token.Position{Offset: 20, Line: 2, Column: 7}},
+		{"[", token.Position{Offset: 23, Line: 3, Column: 3}},
+		{"jump", token.Position{Offset: 24, Line: 3, Column: 4}},
+		{"target", token.Position{Offset: 29, Line: 3, Column: 9}},
+		{"=", token.Position{Offset: 35, Line: 3, Column: 15}},
+		{"ch1", token.Position{Offset: 36, Line: 3, Column: 16}},
+		{"]", token.Position{Offset: 39, Line: 3, Column: 19}},
+		{"", token.Position{Offset: 40, Line: 3, Column: 20}},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedPos, tok.Pos)
+	}
+}
+
+func TestNextToken_不正なUTF8を処理できる(t *testing.T) {
+	input := "あ\xffい\n[p\xfe]"
+	l := NewLexer(input)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.TEXT, "あ", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.ILLEGAL, "\xff", token.Position{Offset: 3, Line: 1, Column: 2}},
+		{token.TEXT, "い", token.Position{Offset: 4, Line: 1, Column: 3}},
+		{token.NEWLINE, "\n", token.Position{Offset: 7, Line: 1, Column: 4}},
+		{token.LBRACKET, "[", token.Position{Offset: 8, Line: 2, Column: 1}},
+		{token.IDENT, "p", token.Position{Offset: 9, Line: 2, Column: 2}},
+		{token.ILLEGAL, "\xfe", token.Position{Offset: 10, Line: 2, Column: 3}},
+		{token.RBRACKET, "]", token.Position{Offset: 11, Line: 2, Column: 4}},
+		{token.EOF, "", token.Position{Offset: 12, Line: 2, Column: 5}},
+	}
+
+	for _, tt := range tests {
+		tok := l.NextToken()
+
+		assert.Equal(t, tt.expectedType, tok.Type)
+		assert.Equal(t, tt.expectedLiteral, tok.Literal)
+		assert.Equal(t, tt.expectedPos, tok.Pos)
+	}
+}
+
+func TestNewLexerFromReader_少しずつ読み込める(t *testing.T) {
+	input := `*開始
+/* ブロック
+コメント */
+あ\xffい[jump target="第一章" n=-1.5]`
+	// 1バイトずつ返すReaderで、文字の途中で読み込みが分かれても同じ結果になる
+	l := NewLexerFromReader(iotest.OneByteReader(strings.NewReader(input)))
+	expect := NewLexer(input)
+
+	for {
+		tok := l.NextToken()
+		assert.Equal(t, expect.NextToken(), tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	assert.NoError(t, l.Err())
+}
+
+func TestNewLexerFromReader_読み込みエラーを返す(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("本文"), iotest.ErrReader(errors.New("読み込み失敗")))
+	l := NewLexerFromReader(r)
+
+	assert.Equal(t, token.Token{Type: token.TEXT, Literal: "本文", Pos: token.Position{Offset: 0, Line: 1, Column: 1}}, l.NextToken())
+	assert.Equal(t, token.EOF, string(l.NextToken().Type))
+	assert.EqualError(t, l.Err(), "読み込み失敗")
+}
+
+func BenchmarkLexer(b *testing.B) {
+	input := fixture.LargeScenario(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := NewLexerFromReader(strings.NewReader(input))
+		for l.NextToken().Type != token.EOF {
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package loader
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kijimaD/nova/bytecode"
 	"github.com/kijimaD/nova/event"
 	"github.com/kijimaD/nova/lexer"
 	"github.com/kijimaD/nova/parser"
@@ -8,17 +14,78 @@ import (
 
 // 依存関係のせいで、適当に配置できない
 // スクリプトからキューを初期化する
-func NewQueueFromText(text string) (event.Queue, error) {
-	l := lexer.NewLexer(text)
+func NewQueueFromText(text string) (*event.Queue, error) {
+	return NewQueueFromReader(strings.NewReader(text))
+}
+
+// 読み込みながらキューを初期化する
+// ファイル全体のASTを作らずに、文ごとに評価する
+func NewQueueFromReader(r io.Reader) (*event.Queue, error) {
+	l := lexer.NewLexerFromReader(r)
 	p := parser.NewParser(l)
-	program, err := p.ParseProgram()
-	if err != nil {
-		return event.Queue{}, err
-	}
 	e := event.NewEvaluator()
-	e.Eval(program)
+	for {
+		stmt, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.Eval(stmt)
+	}
 	q := event.NewQueue(e)
-	q.Evaluator.Events = e.Events
 
 	return q, nil
 }
+
+// コンパイル済みのシナリオからキューを初期化する
+// バージョンが異なるときはbytecode.ErrIncompatibleVersionを返す
+func NewQueueFromBytecode(r io.Reader) (*event.Queue, error) {
+	labels, err := bytecode.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.NewQueue(event.NewEvaluatorFromCompiled(labels)), nil
+}
+
+// シナリオを読み込み、すべてのラベルをコンパイルした評価器を返す
+// 構文エラーと不正な値は、最初で止めずにまとめて返す
+func NewEvaluatorFromReader(r io.Reader) (*event.Evaluator, error) {
+	l := lexer.NewLexerFromReader(r)
+	p := parser.NewParser(l)
+	e := event.NewEvaluator()
+	for {
+		stmt, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && len(p.ErrorList()) == 0 {
+			// 構文エラー以外の読み込みエラーは続けられない
+			return nil, err
+		}
+		if err == nil {
+			e.Eval(stmt)
+		}
+	}
+
+	errs := []error{}
+	for _, err := range p.ErrorList() {
+		errs = append(errs, err)
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	if _, err := e.CompileAll(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, err := range e.Errors() {
+		errs = append(errs, fmt.Errorf("不正な値: %w", err))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return e, nil
+}
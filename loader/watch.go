@@ -0,0 +1,133 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+)
+
+// 確認する間隔のデフォルト
+const DefaultInterval = 500 * time.Millisecond
+
+// 開発用に、シナリオファイルの変更を監視してキューに読み込み直す
+// 外部のライブラリを使わず、一定間隔でファイルを確認する
+// 読み込みに失敗しても止まらず、エラーを通知して次の変更を待つ
+type Watcher struct {
+	Path  string
+	Queue *event.Queue
+	// 確認する間隔
+	Interval time.Duration
+	// 読み込み直したときに呼ぶ
+	OnReload func()
+	// 読み込み直せなかったときに呼ぶ。指定しないときはログに出力する
+	OnError func(err error)
+
+	// 最後に確認したときの更新日時と内容
+	modTime time.Time
+	content []byte
+	// 読み込めたが、キューが表示中で差し替えられていない評価器
+	pending *event.Evaluator
+}
+
+// 起動時に読み込んだ内容を基準にして、監視を準備する
+func NewWatcher(path string, q *event.Queue) (*Watcher, error) {
+	w := &Watcher{Path: path, Queue: q, Interval: DefaultInterval}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w.modTime = info.ModTime()
+	w.content = content
+
+	return w, nil
+}
+
+// stopが閉じられるまで、一定間隔でCheck()する
+func (w *Watcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := w.Check()
+			if err != nil {
+				w.report(err)
+				continue
+			}
+			if reloaded && w.OnReload != nil {
+				w.OnReload()
+			}
+		}
+	}
+}
+
+// ファイルを1回確認し、変更されていれば読み込み直してキューを差し替える
+// 差し替えたときはtrueを返す。キューが表示中で差し替えられないときは、次の確認で再び試す
+func (w *Watcher) Check() (bool, error) {
+	if err := w.load(); err != nil {
+		return false, err
+	}
+	if w.pending == nil {
+		return false, nil
+	}
+
+	err := w.Queue.Reload(w.pending)
+	if errors.Is(err, event.ErrBusy) {
+		return false, nil
+	}
+	w.pending = nil
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", w.Path, err)
+	}
+
+	return true, nil
+}
+
+// 内容が変わっていれば解析し、差し替え待ちにする
+func (w *Watcher) load() error {
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == int64(len(w.content)) {
+		return nil
+	}
+	content, err := os.ReadFile(w.Path)
+	if err != nil {
+		return err
+	}
+	w.modTime = info.ModTime()
+	if bytes.Equal(content, w.content) {
+		return nil
+	}
+	w.content = content
+
+	e, err := NewEvaluatorFromReader(bytes.NewReader(content))
+	if err != nil {
+		// 前に読み込めた内容のまま続ける
+		w.pending = nil
+		return fmt.Errorf("%s: %w", w.Path, err)
+	}
+	w.pending = e
+
+	return nil
+}
+
+func (w *Watcher) report(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+		return
+	}
+	log.Printf("読み込み直せない: %s", err)
+}
@@ -0,0 +1,93 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareWatcher(t *testing.T, input string) (*Watcher, *event.Queue) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "input.sce")
+	assert.NoError(t, os.WriteFile(path, []byte(input), 0o644))
+	q, err := NewQueueFromText(input)
+	assert.NoError(t, err)
+	config := q.Config()
+	config.Instant = true
+	q.SetConfig(config)
+	w, err := NewWatcher(path, q)
+	assert.NoError(t, err)
+
+	return w, q
+}
+
+func TestWatcher_変更されたら読み込み直す(t *testing.T) {
+	w, q := prepareWatcher(t, "*start\nあ[p]\nい[p]\n")
+	q.Start()
+	q.Wait()
+
+	reloaded, err := w.Check()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	assert.NoError(t, os.WriteFile(w.Path, []byte("*start\nああ[p]\nい[p]\n"), 0o644))
+	reloaded, err = w.Check()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	q.Wait()
+	assert.Equal(t, "ああ", q.Display())
+}
+
+func TestWatcher_エラーのときは前の内容で続ける(t *testing.T) {
+	w, q := prepareWatcher(t, "*start\nあ[p]\nい[p]\n")
+	q.Start()
+	q.Wait()
+
+	assert.NoError(t, os.WriteFile(w.Path, []byte("*start\nああ[p]\n[wait time]\n[image]\n"), 0o644))
+	reloaded, err := w.Check()
+	assert.False(t, reloaded)
+	assert.ErrorContains(t, err, w.Path+": 3:7: シンタックスエラー: EQUALがない: time")
+	q.Run()
+	q.Wait()
+	assert.Equal(t, "い", q.Display())
+
+	// 直すと読み込み直す
+	assert.NoError(t, os.WriteFile(w.Path, []byte("*start\nあ[p]\nいい[p]\n"), 0o644))
+	reloaded, err = w.Check()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	q.Wait()
+	assert.Equal(t, "いい", q.Display())
+}
+
+func TestWatcher_一定間隔で確認する(t *testing.T) {
+	w, q := prepareWatcher(t, "*start\nあ[p]\n")
+	w.Interval = time.Millisecond
+	reloaded := make(chan struct{}, 1)
+	w.OnReload = func() { reloaded <- struct{}{} }
+	q.Start()
+	q.Wait()
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.Run(stop)
+
+	assert.NoError(t, os.WriteFile(w.Path, []byte("*start\nああ[p]\n"), 0o644))
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("読み込み直さなかった")
+	}
+	q.Wait()
+	assert.Equal(t, "ああ", q.Display())
+}
+
+func TestNewEvaluatorFromReader_不正な値を報告する(t *testing.T) {
+	_, err := NewEvaluatorFromReader(strings.NewReader("*start\n[wait time=abc]\n"))
+	assert.EqualError(t, err, `2:1: 不正な値: time: invalid duration "abcms"`)
+}
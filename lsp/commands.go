@@ -0,0 +1,109 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kijimaD/nova/token"
+)
+
+// コマンドの説明。補完とホバーに使う
+type command struct {
+	name   string
+	doc    string
+	params []param
+}
+
+type param struct {
+	name     string
+	doc      string
+	required bool
+}
+
+var commands = []command{
+	{name: token.CMD_FLUSH, doc: "クリック待ちにし、クリック時に表示内容をリセットする"},
+	{name: token.CMD_LINE_END_WAIT, doc: "クリック待ちにし、クリック時に改行する"},
+	{name: token.CMD_NEWLINE, doc: "改行する"},
+	{name: token.CMD_IMAGE, doc: "背景を表示する", params: []param{
+		{name: "source", doc: "画像のパス", required: true},
+	}},
+	{name: token.CMD_JUMP, doc: "ラベルに移動する", params: []param{
+		{name: "target", doc: "移動先のラベル", required: true},
+	}},
+	{name: token.CMD_WAIT, doc: "指定時間、操作待ちにする", params: []param{
+		{name: "time", doc: "待つ時間(ミリ秒)", required: true},
+	}},
+	{name: token.CMD_DELAY, doc: "文字表示速度を変更する", params: []param{
+		{name: "speed", doc: "1文字ごとに待つ時間(ミリ秒)。nowaitで一気に表示する", required: true},
+	}},
+	{name: token.CMD_FONT, doc: "以降の文字を装飾する。指定した項目だけ変更する", params: []param{
+		{name: "color", doc: "文字色。#ff0000の形式"},
+		{name: "size", doc: "文字の大きさの倍率"},
+		{name: "bold", doc: "太字にするか。trueかfalse"},
+		{name: "italic", doc: "斜体にするか。trueかfalse"},
+		{name: "emphasis", doc: "傍点をつけるか。trueかfalse"},
+	}},
+	{name: token.CMD_RESET_FONT, doc: "文字の装飾を元に戻す"},
+	{name: token.CMD_RUBY, doc: "[endruby]までの文字にルビをふる", params: []param{
+		{name: "text", doc: "ルビ", required: true},
+	}},
+	{name: token.CMD_END_RUBY, doc: "ルビの終わり"},
+	{name: token.CMD_CHOICE, doc: "選択肢を追加する。選ぶとラベルに移動する", params: []param{
+		{name: "text", doc: "表示する文言", required: true},
+		{name: "target", doc: "選んだときの移動先のラベル", required: true},
+	}},
+	{name: token.CMD_SELECT, doc: "それまでに追加した選択肢を表示し、選択待ちにする"},
+}
+
+// ラベル名を値にとるパラメータ
+const targetParam = "target"
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+
+	return command{}, false
+}
+
+func (c command) lookupParam(name string) (param, bool) {
+	for _, p := range c.params {
+		if p.name == name {
+			return p, true
+		}
+	}
+
+	return param{}, false
+}
+
+// 書式の例。[jump target=...]
+func (c command) signature() string {
+	var out strings.Builder
+	out.WriteString("[" + c.name)
+	for _, p := range c.params {
+		fmt.Fprintf(&out, " %s=...", p.name)
+	}
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// ホバーで表示するMarkdown
+func (c command) markdown() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "```\n%s\n```\n\n%s\n", c.signature(), c.doc)
+	for i, p := range c.params {
+		if i == 0 {
+			out.WriteString("\n")
+		}
+		required := ""
+		if p.required {
+			required = " (必須)"
+		}
+		fmt.Fprintf(&out, "- `%s`%s: %s\n", p.name, required, p.doc)
+	}
+
+	return out.String()
+}
@@ -0,0 +1,367 @@
+package lsp
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/kijimaD/nova/token"
+)
+
+// 診断につける発生元
+const source = "nova"
+
+// 開いているファイルを解析した結果
+type document struct {
+	uri   string
+	lines []string
+	// ラベルの定義。定義順に並べる
+	labels []labelDef
+	// [jump target]などのラベルの参照
+	refs []labelRef
+	// コマンド名の位置。ホバーに使う
+	cmds        []cmdUse
+	diagnostics []Diagnostic
+}
+
+type labelDef struct {
+	name string
+	// ラベル名の範囲
+	nameRange Range
+	// 次のラベルの直前までの範囲
+	rng Range
+}
+
+type labelRef struct {
+	name string
+	// 値の範囲。引用符で囲まれているときは、引用符の内側
+	rng Range
+}
+
+type cmdUse struct {
+	name      string
+	nameRange Range
+}
+
+func newDocument(uri string, text string) *document {
+	d := &document{
+		uri:         uri,
+		lines:       strings.Split(text, "\n"),
+		labels:      []labelDef{},
+		refs:        []labelRef{},
+		cmds:        []cmdUse{},
+		diagnostics: []Diagnostic{},
+	}
+
+	// エラーの後も続けて、解析できたところまでを使う
+	p := parser.NewParser(lexer.NewLexer(text))
+	for {
+		n := len(p.ErrorList())
+		stmt, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && len(p.ErrorList()) == n {
+			// 構文エラーでなければ先に進めない
+			break
+		}
+		d.walk(stmt)
+	}
+	for _, e := range p.ErrorList() {
+		start := d.position(e.Pos)
+		d.diagnose(Range{Start: start, End: Position{Line: start.Line, Character: start.Character + 1}}, SeverityError, e.Msg)
+	}
+
+	d.finishLabels()
+	defined := map[string]bool{}
+	for _, l := range d.labels {
+		if defined[l.name] {
+			d.diagnose(l.nameRange, SeverityWarning, fmt.Sprintf("ラベルが重複している。最初の定義を使う: %s", l.name))
+		}
+		defined[l.name] = true
+	}
+	for _, r := range d.refs {
+		if !defined[r.name] {
+			d.diagnose(r.rng, SeverityError, fmt.Sprintf("存在しないラベル: %s", r.name))
+		}
+	}
+
+	return d
+}
+
+func (d *document) diagnose(rng Range, severity int, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{Range: rng, Severity: severity, Source: source, Message: msg})
+}
+
+func (d *document) walk(stmt ast.Statement) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return
+	}
+	switch node := es.Expression.(type) {
+	case *ast.LabelLiteral:
+		name := node.LabelName.Value
+		start := d.position(node.Token.Pos)
+		d.labels = append(d.labels, labelDef{
+			name:      name,
+			nameRange: d.wordRange(node.LabelName.Token.Pos, name),
+			rng:       Range{Start: start},
+		})
+		for _, s := range node.Body.Statements {
+			d.walk(s)
+		}
+	case *ast.CmdLiteral:
+		d.command(node)
+	}
+}
+
+func (d *document) command(node *ast.CmdLiteral) {
+	name := node.FuncName.Value
+	nameRange := d.wordRange(node.FuncName.Token.Pos, name)
+	d.cmds = append(d.cmds, cmdUse{name: name, nameRange: nameRange})
+
+	spec, ok := lookupCommand(name)
+	if !ok {
+		d.diagnose(nameRange, SeverityWarning, fmt.Sprintf("不明なコマンド: %s", name))
+		return
+	}
+	for _, p := range spec.params {
+		if _, ok := node.Parameters.Map[p.name]; p.required && !ok {
+			d.diagnose(nameRange, SeverityError, fmt.Sprintf("必須のパラメータがない: %s", p.name))
+		}
+	}
+	keys := []string{}
+	for key := range node.Parameters.Map {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rng := d.valueRange(node.Parameters.Map[key])
+		if _, ok := spec.lookupParam(key); !ok {
+			d.diagnose(rng, SeverityWarning, fmt.Sprintf("不明なパラメータ: %s", key))
+		}
+		if key == targetParam {
+			d.refs = append(d.refs, labelRef{name: node.Parameters.Get(key), rng: rng})
+		}
+	}
+
+	// 値の検査は、実行時と同じくイベントへの変換に任せる
+	e := event.NewEvaluator()
+	e.Eval(node)
+	for _, err := range e.Errors() {
+		d.diagnose(nameRange, SeverityError, fmt.Sprintf("不正な値: %s", err))
+	}
+}
+
+// ラベルの範囲を、次のラベルの直前の行末までにする
+func (d *document) finishLabels() {
+	for i := range d.labels {
+		endLine := len(d.lines) - 1
+		if i+1 < len(d.labels) {
+			endLine = d.labels[i+1].rng.Start.Line - 1
+		}
+		if endLine < d.labels[i].rng.Start.Line {
+			endLine = d.labels[i].rng.Start.Line
+		}
+		d.labels[i].rng.End = Position{Line: endLine, Character: utf16Len(d.line(endLine))}
+	}
+}
+
+func (d *document) line(n int) string {
+	if n < 0 || n >= len(d.lines) {
+		return ""
+	}
+
+	return d.lines[n]
+}
+
+// ソース上の位置を、LSPの位置に変換する
+func (d *document) position(pos token.Position) Position {
+	line := []rune(d.line(pos.Line - 1))
+	col := pos.Column - 1
+	if col > len(line) {
+		col = len(line)
+	}
+	if col < 0 {
+		col = 0
+	}
+
+	return Position{Line: pos.Line - 1, Character: utf16Len(string(line[:col]))}
+}
+
+// 位置から始まる単語の範囲
+func (d *document) wordRange(pos token.Position, word string) Range {
+	start := d.position(pos)
+
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + utf16Len(word)}}
+}
+
+// パラメータの値の範囲。引用符で囲まれているときは内側を返す
+func (d *document) valueRange(node ast.Node) Range {
+	var pos token.Position
+	switch node := node.(type) {
+	case *ast.StringLiteral:
+		pos = node.Token.Pos
+	case *ast.Identifier:
+		return d.wordRange(node.Token.Pos, node.Value)
+	case *ast.IntegerLiteral:
+		return d.wordRange(node.Token.Pos, node.Token.Literal)
+	case *ast.FloatLiteral:
+		return d.wordRange(node.Token.Pos, node.Token.Literal)
+	}
+
+	line := []rune(d.line(pos.Line - 1))
+	start := pos.Column - 1
+	if start < 0 || start >= len(line) {
+		p := d.position(pos)
+		return Range{Start: p, End: p}
+	}
+	quote := line[start]
+	end := start + 1
+	for end < len(line) && line[end] != quote {
+		if line[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	n := pos.Line - 1
+
+	return Range{
+		Start: Position{Line: n, Character: utf16Len(string(line[:start+1]))},
+		End:   Position{Line: n, Character: utf16Len(string(line[:end]))},
+	}
+}
+
+// 位置にあるラベルの定義か参照のラベル名を返す
+func (d *document) labelAt(pos Position) (string, bool) {
+	for _, l := range d.labels {
+		if l.nameRange.contains(pos) {
+			return l.name, true
+		}
+	}
+	for _, r := range d.refs {
+		if r.rng.contains(pos) {
+			return r.name, true
+		}
+	}
+
+	return "", false
+}
+
+func (d *document) definition(name string) (labelDef, bool) {
+	for _, l := range d.labels {
+		if l.name == name {
+			return l, true
+		}
+	}
+
+	return labelDef{}, false
+}
+
+// ラベルの参照の範囲を返す。includeDeclarationのときは定義も含める
+func (d *document) references(name string, includeDeclaration bool) []Range {
+	result := []Range{}
+	if includeDeclaration {
+		for _, l := range d.labels {
+			if l.name == name {
+				result = append(result, l.nameRange)
+			}
+		}
+	}
+	for _, r := range d.refs {
+		if r.name == name {
+			result = append(result, r.rng)
+		}
+	}
+
+	return result
+}
+
+func (d *document) commandAt(pos Position) (command, Range, bool) {
+	for _, c := range d.cmds {
+		if !c.nameRange.contains(pos) {
+			continue
+		}
+		if spec, ok := lookupCommand(c.name); ok {
+			return spec, c.nameRange, true
+		}
+	}
+
+	return command{}, Range{}, false
+}
+
+// 入力途中のパラメータ。[jump target="ch
+var paramPattern = regexp.MustCompile(`([^\s=]+)=["']?[^"'\s]*$`)
+
+// カーソル位置に応じた補完候補を返す
+// [の直後ではコマンド名を、コマンド名の後ではパラメータ名を、targetの値ではラベル名を返す
+func (d *document) complete(pos Position) []CompletionItem {
+	result := []CompletionItem{}
+	prefix := d.linePrefix(pos)
+	open := strings.LastIndex(prefix, "[")
+	if open < 0 || strings.Contains(prefix[open:], "]") {
+		return result
+	}
+	inner := prefix[open+1:]
+
+	fields := strings.Fields(inner)
+	if len(fields) == 0 || !strings.ContainsAny(inner, " \t") {
+		for _, c := range commands {
+			result = append(result, CompletionItem{Label: c.name, Kind: CompletionItemKindFunction, Detail: c.signature(), Documentation: c.doc})
+		}
+		return result
+	}
+
+	spec, ok := lookupCommand(fields[0])
+	if !ok {
+		return result
+	}
+	if m := paramPattern.FindStringSubmatch(inner); m != nil {
+		if m[1] == targetParam {
+			seen := map[string]bool{}
+			for _, l := range d.labels {
+				if !seen[l.name] {
+					result = append(result, CompletionItem{Label: l.name, Kind: CompletionItemKindReference, Detail: "ラベル"})
+				}
+				seen[l.name] = true
+			}
+		}
+		return result
+	}
+	for _, p := range spec.params {
+		if strings.Contains(inner, " "+p.name+"=") {
+			continue
+		}
+		result = append(result, CompletionItem{Label: p.name, Kind: CompletionItemKindProperty, Documentation: p.doc})
+	}
+
+	return result
+}
+
+// 行頭からカーソル位置までの文字列
+func (d *document) linePrefix(pos Position) string {
+	line := d.line(pos.Line)
+	n := 0
+	for i, r := range line {
+		if n >= pos.Character {
+			return line[:i]
+		}
+		n += len(utf16.Encode([]rune{r}))
+	}
+
+	return line
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
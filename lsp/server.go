@@ -0,0 +1,287 @@
+// シナリオファイル(.sce)のLanguage Server Protocolサーバーのパッケージ
+// 字句解析器、構文解析器、評価器を使って、診断、補完、定義への移動、参照の検索、シンボル一覧、ホバー、ラベル名の変更を提供する
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/token"
+)
+
+// サーバー名
+const Name = "novals"
+
+// exit通知を受け取った
+var errExit = errors.New("exit")
+
+// 標準入出力などでクライアントとやりとりするサーバー
+// リクエストは受け取った順に1つずつ処理する
+type Server struct {
+	// URIごとの開いているファイル
+	docs map[string]*document
+	w    io.Writer
+	// shutdownリクエストを受け取ったか
+	shutdown bool
+	// 指定すると、処理できなかったメッセージを記録する
+	Logger *log.Logger
+}
+
+func NewServer() *Server {
+	return &Server{docs: map[string]*document{}}
+}
+
+// rからメッセージを読み込み、wに応答を書き込む。exit通知を受け取るか、rが終わるまで続ける
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+	for {
+		body, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.logf("メッセージを解釈できない: %s", err)
+			if err := writeMessage(w, errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &ResponseError{Code: codeParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, err := s.handle(msg)
+		if err == errExit {
+			return nil
+		}
+		if msg.ID == nil {
+			// 通知には応答しない
+			if err != nil {
+				s.logf("%s: %s", msg.Method, err)
+			}
+			continue
+		}
+		if err != nil {
+			rerr, ok := err.(*ResponseError)
+			if !ok {
+				rerr = &ResponseError{Code: codeRequestFailed, Message: err.Error()}
+			}
+			err = writeMessage(w, errorResponse{JSONRPC: "2.0", ID: *msg.ID, Error: rerr})
+		} else {
+			err = writeMessage(w, response{JSONRPC: "2.0", ID: *msg.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+func (s *Server) handle(msg message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       1,
+				CompletionProvider:     &CompletionOptions{TriggerCharacters: []string{"[", " ", "="}},
+				DefinitionProvider:     true,
+				ReferencesProvider:     true,
+				DocumentSymbolProvider: true,
+				HoverProvider:          true,
+				RenameProvider:         true,
+			},
+			ServerInfo: ServerInfo{Name: Name},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "exit":
+		return nil, errExit
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(msg, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(msg, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		d, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.complete(params.Position), nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		d, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.definition(d, params.Position), nil
+	case "textDocument/references":
+		var params ReferenceParams
+		d, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		result := []Location{}
+		if name, ok := d.labelAt(params.Position); ok {
+			for _, rng := range d.references(name, params.Context.IncludeDeclaration) {
+				result = append(result, Location{URI: d.uri, Range: rng})
+			}
+		}
+		return result, nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		d, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		result := []DocumentSymbol{}
+		for _, l := range d.labels {
+			result = append(result, DocumentSymbol{Name: l.name, Kind: SymbolKindNamespace, Range: l.rng, SelectionRange: l.nameRange})
+		}
+		return result, nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		d, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.hover(d, params.Position), nil
+	case "textDocument/rename":
+		var params RenameParams
+		d, err := s.document(msg, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.rename(d, params.Position, params.NewName)
+	}
+
+	if msg.ID == nil {
+		// $/cancelRequestなど、対応しない通知は無視する
+		return nil, nil
+	}
+
+	return nil, &ResponseError{Code: codeMethodNotFound, Message: fmt.Sprintf("対応していないメソッド: %s", msg.Method)}
+}
+
+func decode(msg message, params any) error {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// パラメータを読み込んで、対象のファイルを返す
+func (s *Server) document(msg message, params any, id *TextDocumentIdentifier) (*document, error) {
+	if err := decode(msg, params); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[id.URI]
+	if !ok {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("開かれていないファイル: %s", id.URI)}
+	}
+
+	return d, nil
+}
+
+// ファイルを解析し直して、診断を通知する
+func (s *Server) update(uri string, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: d.diagnostics})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.w, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) definition(d *document, pos Position) *Location {
+	name, ok := d.labelAt(pos)
+	if !ok {
+		return nil
+	}
+	l, ok := d.definition(name)
+	if !ok {
+		return nil
+	}
+
+	return &Location{URI: d.uri, Range: l.nameRange}
+}
+
+func (s *Server) hover(d *document, pos Position) *Hover {
+	if c, rng, ok := d.commandAt(pos); ok {
+		return &Hover{Contents: MarkupContent{Kind: "markdown", Value: c.markdown()}, Range: &rng}
+	}
+	name, ok := d.labelAt(pos)
+	if !ok {
+		return nil
+	}
+	value := fmt.Sprintf("ラベル `%s`: 定義がない", name)
+	if l, ok := d.definition(name); ok {
+		refs := len(d.references(name, false))
+		value = fmt.Sprintf("ラベル `%s`: %d行目で定義、参照%d件", name, l.nameRange.Start.Line+1, refs)
+	}
+
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}}
+}
+
+// ラベルの定義とすべての参照を書き換える
+func (s *Server) rename(d *document, pos Position, newName string) (*WorkspaceEdit, error) {
+	name, ok := d.labelAt(pos)
+	if !ok {
+		return nil, &ResponseError{Code: codeRequestFailed, Message: "ラベルの上ではない"}
+	}
+	if !isLabelName(newName) {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: fmt.Sprintf("ラベル名に使えない: %q", newName)}
+	}
+
+	edits := []TextEdit{}
+	for _, rng := range d.references(name, true) {
+		edits = append(edits, TextEdit{Range: rng, NewText: newName})
+	}
+
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}, nil
+}
+
+// 識別子として1つのトークンになるか
+func isLabelName(name string) bool {
+	l := lexer.NewLexer("[" + name + "]")
+	l.NextToken()
+	tok := l.NextToken()
+
+	return tok.Type == token.IDENT && tok.Literal == name
+}
@@ -0,0 +1,297 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 標準入出力の代わりにパイプでサーバーとやりとりするクライアント
+type client struct {
+	t *testing.T
+	w io.WriteCloser
+	// サーバーから届いたメッセージ。書き込みで詰まらないように別のゴルーチンで読む
+	msgs   chan []byte
+	nextID int
+	done   chan error
+	// 受け取った通知
+	notifications []notification
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, msgs: make(chan []byte, 100), done: make(chan error, 1)}
+	go func() {
+		err := NewServer().Serve(inR, outW)
+		outW.Close()
+		c.done <- err
+	}()
+	go func() {
+		r := bufio.NewReader(outR)
+		for {
+			body, err := readMessage(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- body
+		}
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+	})
+
+	return c
+}
+
+// リクエストを送って、応答が来るまでに受け取った通知をためる
+func (c *client) request(method string, params any, result any) *ResponseError {
+	c.t.Helper()
+
+	c.nextID++
+	id := c.nextID
+	assert.NoError(c.t, writeMessage(c.w, map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}))
+	for {
+		body, ok := <-c.msgs
+		if !assert.True(c.t, ok, "応答の前にサーバーが終了した") {
+			return nil
+		}
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *ResponseError  `json:"error"`
+		}
+		assert.NoError(c.t, json.Unmarshal(body, &msg))
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, notification{Method: msg.Method, Params: msg.Params})
+			continue
+		}
+		assert.Equal(c.t, id, *msg.ID)
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			assert.NoError(c.t, json.Unmarshal(msg.Result, result))
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+
+	assert.NoError(c.t, writeMessage(c.w, map[string]any{"jsonrpc": "2.0", "method": method, "params": params}))
+}
+
+// 直前の通知で送られた診断を返す。通知は次のリクエストの応答までに読み込む
+func (c *client) diagnostics() []Diagnostic {
+	c.t.Helper()
+
+	c.request("shutdown", nil, nil)
+	for i := len(c.notifications) - 1; i >= 0; i-- {
+		n := c.notifications[i]
+		if n.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		assert.NoError(c.t, json.Unmarshal(n.Params.(json.RawMessage), &params))
+		return params.Diagnostics
+	}
+
+	return nil
+}
+
+const uri = "file:///scenario.sce"
+
+const input = `*start
+はじまり[p]
+[jump target="第一章"]
+*第一章
+[image source="bg.png"]
+[choice text="戻る" target=start]
+[select]
+`
+
+func open(t *testing.T, text string) *client {
+	t.Helper()
+
+	c := newClient(t)
+	var init InitializeResult
+	assert.Nil(t, c.request("initialize", map[string]any{"capabilities": map[string]any{}}, &init))
+	assert.True(t, init.Capabilities.RenameProvider)
+	c.notify("initialized", map[string]any{})
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "nova", Version: 1, Text: text}})
+
+	return c
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{Line: line, Character: character}}
+}
+
+func rng(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestServer_問題がなければ診断は空(t *testing.T) {
+	c := open(t, input)
+
+	assert.Equal(t, []Diagnostic{}, c.diagnostics())
+}
+
+func TestServer_問題を診断する(t *testing.T) {
+	c := open(t, `*start
+[jump target=ch9]
+[wait time=abc]
+[image]
+[unknown]
+[font colour="#fff"]
+*start
+[font bold]`)
+
+	assert.Equal(t, []Diagnostic{
+		{Range: rng(2, 1, 5), Severity: SeverityError, Source: source, Message: `不正な値: time: invalid duration "abcms"`},
+		{Range: rng(3, 1, 6), Severity: SeverityError, Source: source, Message: "必須のパラメータがない: source"},
+		{Range: rng(4, 1, 8), Severity: SeverityWarning, Source: source, Message: "不明なコマンド: unknown"},
+		{Range: rng(5, 14, 18), Severity: SeverityWarning, Source: source, Message: "不明なパラメータ: colour"},
+		{Range: rng(7, 6, 7), Severity: SeverityError, Source: source, Message: "シンタックスエラー: EQUALがない: bold"},
+		{Range: rng(6, 1, 6), Severity: SeverityWarning, Source: source, Message: "ラベルが重複している。最初の定義を使う: start"},
+		{Range: rng(1, 13, 16), Severity: SeverityError, Source: source, Message: "存在しないラベル: ch9"},
+	}, c.diagnostics())
+}
+
+func TestServer_変更すると診断し直す(t *testing.T) {
+	c := open(t, input)
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "*start\n[jump target=nothing]\n"}},
+	})
+
+	diagnostics := c.diagnostics()
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, "存在しないラベル: nothing", diagnostics[0].Message)
+}
+
+func TestServer_コマンド名を補完する(t *testing.T) {
+	c := open(t, input+"[ju")
+	var items []CompletionItem
+	assert.Nil(t, c.request("textDocument/completion", at(7, 3), &items))
+
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Label)
+	}
+	assert.Contains(t, names, "jump")
+	assert.Contains(t, names, "choice")
+}
+
+func TestServer_パラメータ名を補完する(t *testing.T) {
+	c := open(t, input+`[choice text="x" `)
+	var items []CompletionItem
+	assert.Nil(t, c.request("textDocument/completion", at(7, 17), &items))
+
+	assert.Equal(t, []CompletionItem{{Label: "target", Kind: CompletionItemKindProperty, Documentation: "選んだときの移動先のラベル"}}, items)
+}
+
+func TestServer_ラベル名を補完する(t *testing.T) {
+	c := open(t, input+`[jump target="`)
+	var items []CompletionItem
+	assert.Nil(t, c.request("textDocument/completion", at(7, 14), &items))
+
+	assert.Equal(t, []CompletionItem{
+		{Label: "start", Kind: CompletionItemKindReference, Detail: "ラベル"},
+		{Label: "第一章", Kind: CompletionItemKindReference, Detail: "ラベル"},
+	}, items)
+}
+
+func TestServer_ラベルの定義へ移動する(t *testing.T) {
+	c := open(t, input)
+	var loc Location
+	assert.Nil(t, c.request("textDocument/definition", at(2, 15), &loc))
+
+	assert.Equal(t, Location{URI: uri, Range: rng(3, 1, 4)}, loc)
+}
+
+func TestServer_ラベルの参照を探す(t *testing.T) {
+	c := open(t, input)
+	var locs []Location
+	params := ReferenceParams{TextDocumentPositionParams: at(0, 2), Context: ReferenceContext{IncludeDeclaration: true}}
+	assert.Nil(t, c.request("textDocument/references", params, &locs))
+
+	assert.Equal(t, []Location{
+		{URI: uri, Range: rng(0, 1, 6)},
+		{URI: uri, Range: rng(5, 25, 30)},
+	}, locs)
+}
+
+func TestServer_ラベルの一覧を返す(t *testing.T) {
+	c := open(t, input)
+	var symbols []DocumentSymbol
+	assert.Nil(t, c.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols))
+
+	assert.Equal(t, []DocumentSymbol{
+		{Name: "start", Kind: SymbolKindNamespace, Range: Range{Start: Position{0, 0}, End: Position{2, 19}}, SelectionRange: rng(0, 1, 6)},
+		{Name: "第一章", Kind: SymbolKindNamespace, Range: Range{Start: Position{3, 0}, End: Position{7, 0}}, SelectionRange: rng(3, 1, 4)},
+	}, symbols)
+}
+
+func TestServer_コマンドの説明を表示する(t *testing.T) {
+	c := open(t, input)
+	var hover Hover
+	assert.Nil(t, c.request("textDocument/hover", at(4, 2), &hover))
+
+	assert.Equal(t, "markdown", hover.Contents.Kind)
+	assert.Equal(t, "```\n[image source=...]\n```\n\n背景を表示する\n\n- `source` (必須): 画像のパス\n", hover.Contents.Value)
+	assert.Equal(t, rng(4, 1, 6), *hover.Range)
+}
+
+func TestServer_ラベルの説明を表示する(t *testing.T) {
+	c := open(t, input)
+	var hover Hover
+	assert.Nil(t, c.request("textDocument/hover", at(2, 15), &hover))
+
+	assert.Equal(t, "ラベル `第一章`: 4行目で定義、参照1件", hover.Contents.Value)
+}
+
+func TestServer_ラベル名を変更する(t *testing.T) {
+	c := open(t, input)
+	var edit WorkspaceEdit
+	params := RenameParams{TextDocumentPositionParams: at(3, 2), NewName: "序章"}
+	assert.Nil(t, c.request("textDocument/rename", params, &edit))
+
+	assert.Equal(t, map[string][]TextEdit{uri: {
+		{Range: rng(3, 1, 4), NewText: "序章"},
+		{Range: rng(2, 14, 17), NewText: "序章"},
+	}}, edit.Changes)
+}
+
+func TestServer_ラベル名に使えない名前には変更しない(t *testing.T) {
+	c := open(t, input)
+	params := RenameParams{TextDocumentPositionParams: at(3, 2), NewName: "a b"}
+	err := c.request("textDocument/rename", params, nil)
+
+	assert.Equal(t, codeInvalidParams, err.Code)
+}
+
+func TestServer_対応していないメソッドはエラーを返す(t *testing.T) {
+	c := open(t, input)
+	err := c.request("textDocument/formatting", at(0, 0), nil)
+
+	assert.Equal(t, codeMethodNotFound, err.Code)
+}
+
+func TestServer_exitで終了する(t *testing.T) {
+	c := open(t, input)
+	c.request("shutdown", nil, nil)
+	c.notify("exit", nil)
+
+	assert.NoError(t, <-c.done)
+}
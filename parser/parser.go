@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 
 	"github.com/kijimaD/nova/token"
@@ -12,11 +14,14 @@ import (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Error
 
 	curToken  token.Token // 現在のトークン
 	peekToken token.Token // 次のトークン
 
+	curComments  []*ast.Comment // 現在のトークンの直前にあるコメント
+	peekComments []*ast.Comment // 次のトークンの直前にあるコメント
+
 	// 構文解析関数
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -48,7 +53,7 @@ var precedences = map[token.TokenType]int{
 func NewParser(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []Error{},
 	}
 
 	// 前置トークン
@@ -65,24 +70,68 @@ func NewParser(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// 位置つきの構文エラー
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
 // エラーのアクセサ
 func (p *Parser) Errors() []string {
+	result := []string{}
+	for _, e := range p.errors {
+		result = append(result, e.Error())
+	}
+
+	return result
+}
+
+// 位置つきのエラーを返す。エディタで該当箇所を示すのに使う
+func (p *Parser) ErrorList() []Error {
 	return p.errors
 }
 
 // エラーを追加する
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.addError(p.peekToken.Pos, "expected next token to be %s, got %s instead",
 		t,
 		p.peekToken.Type,
 	)
-	p.errors = append(p.errors, msg)
+}
+
+// 位置をつけてエラーを追加する
+func (p *Parser) addError(pos token.Position, format string, a ...interface{}) {
+	p.errors = append(p.errors, Error{Pos: pos, Msg: fmt.Sprintf(format, a...)})
 }
 
 // 次のトークンに進む
+// コメントは構文に含めず、直後のトークンに紐づけておく
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	p.curComments = p.peekComments
+
+	p.peekComments = nil
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.peekComments = append(p.peekComments, newComment(p.peekToken))
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+// コメントの記号を取り除いて、内容を取り出す
+func newComment(tok token.Token) *ast.Comment {
+	text := tok.Literal
+	if strings.HasPrefix(text, ";") {
+		text = strings.TrimPrefix(text, ";")
+	} else {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	}
+
+	return &ast.Comment{Token: tok, Text: strings.TrimSpace(text)}
 }
 
 // パースを開始する。トークンを1つずつ辿る
@@ -90,20 +139,46 @@ func (p *Parser) ParseProgram() (*ast.Program, error) {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+	for !p.curTokenIs(token.EOF) {
+		stmt, err := p.Next()
+		if err != nil {
+			// エラーをまとめて返すため、最後まで続ける
+			continue
 		}
-		p.nextToken()
+		program.Statements = append(program.Statements, stmt)
 	}
+	program.Comments = p.curComments
 	if len(p.errors) != 0 {
-		return nil, fmt.Errorf(strings.Join(p.errors, ","))
+		return nil, fmt.Errorf(strings.Join(p.Errors(), ","))
+	}
+	if err := p.l.Err(); err != nil {
+		return nil, err
 	}
 
 	return program, nil
 }
 
+// 次の文をパースして返す。末尾に到達したらio.EOFを返す
+// ファイル全体のASTを保持しないので、大きなシナリオを少しずつ処理できる
+// ラベルは本体ごと1つの文になる。構文エラーのときも、解析できたところまでの文をエラーと一緒に返す
+func (p *Parser) Next() (ast.Statement, error) {
+	if p.curTokenIs(token.EOF) {
+		if err := p.l.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	n := len(p.errors)
+	stmt := p.parseStatement()
+	p.nextToken()
+	if len(p.errors) > n {
+		return stmt, fmt.Errorf(strings.Join(p.Errors()[n:], ","))
+	}
+
+	return stmt, nil
+}
+
 // 文をパースする。トークンの型によって適用関数を変える
 // 文の中に、式文や式がある
 func (p *Parser) parseStatement() ast.Statement {
@@ -113,7 +188,7 @@ func (p *Parser) parseStatement() ast.Statement {
 
 // 式文を構文解析する
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt := &ast.ExpressionStatement{Token: p.curToken, Comments: p.curComments}
 	stmt.Expression = p.parseExpression(LOWEST)
 	return stmt
 }
@@ -147,7 +222,7 @@ func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
+		p.noPrefixParseFnError(p.curToken)
 		return nil
 	}
 	leftExp := prefix()
@@ -178,9 +253,12 @@ func (p *Parser) peekPrecedence() int {
 	return LOWEST
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) noPrefixParseFnError(t token.Token) {
+	if t.Type == token.ILLEGAL {
+		p.addError(t.Pos, "不正なトークン: %q", t.Literal)
+		return
+	}
+	p.addError(t.Pos, "no prefix parse function for %s found", t.Type)
 }
 
 // 文字列トークンをパース
@@ -209,29 +287,33 @@ func (p *Parser) parseCmdLiteral() ast.Expression {
 // 0~任意の組のパラメータがあるので、ループ内で次のトークンに進むようにする
 func (p *Parser) parseCmdParameters() ast.NamedParams {
 	namedParams := ast.NamedParams{}
-	namedParams.Map = map[string]string{}
+	namedParams.Map = map[string]ast.Expression{}
 
 	for !p.peekTokenIs(token.RBRACKET) {
 		p.nextToken() // -> storage
 
 		name := ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		if !p.peekTokenIs(token.EQUAL) {
-			p.errors = append(p.errors, fmt.Sprintf("シンタックスエラー: EQUALがない: %s", p.curToken.Literal))
+			p.addError(p.curToken.Pos, "シンタックスエラー: EQUALがない: %s", p.curToken.Literal)
 			break
 		}
 		p.nextToken() // -> =
-		if !p.peekTokenIs(token.STRING) {
-			p.errors = append(p.errors, fmt.Sprintf("シンタックスエラー: STRINGがない: %s", p.curToken.Literal))
+		if !p.peekTokenIs(token.STRING) && !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) && !p.peekTokenIs(token.IDENT) {
+			p.addError(p.peekToken.Pos, "シンタックスエラー: 値がない: %s", name.Value)
 			break
 		}
 		p.nextToken() // -> "test.png"
-		namedParams.Map[name.Value] = p.curToken.Literal
+		value := p.parseParamValue()
+		if value == nil {
+			break
+		}
+		namedParams.Map[name.Value] = value
 
 		if p.peekTokenIs(token.RBRACKET) {
 			break
 		}
 		if p.peekTokenIs(token.EOF) {
-			p.errors = append(p.errors, "対応する右ブラケットが存在しなかったため、末尾まで到達した")
+			p.addError(p.peekToken.Pos, "対応する右ブラケットが存在しなかったため、末尾まで到達した")
 			break
 		}
 	}
@@ -239,6 +321,33 @@ func (p *Parser) parseCmdParameters() ast.NamedParams {
 	return namedParams
 }
 
+// パラメータの値をパースする。解釈できないときはnilを返す
+// "test.png" 'test.png' 500 1.5 ch1
+func (p *Parser) parseParamValue() ast.Expression {
+	switch p.curToken.Type {
+	case token.STRING:
+		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	case token.INT:
+		v, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+		if err != nil {
+			p.addError(p.curToken.Pos, "シンタックスエラー: 整数として解釈できない: %s", p.curToken.Literal)
+			return nil
+		}
+		return &ast.IntegerLiteral{Token: p.curToken, Value: v}
+	case token.FLOAT:
+		v, err := strconv.ParseFloat(p.curToken.Literal, 64)
+		if err != nil {
+			p.addError(p.curToken.Pos, "シンタックスエラー: 小数として解釈できない: %s", p.curToken.Literal)
+			return nil
+		}
+		return &ast.FloatLiteral{Token: p.curToken, Value: v}
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	return nil
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -1,10 +1,14 @@
 package parser
 
 import (
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/kijimaD/nova/ast"
+	"github.com/kijimaD/nova/internal/fixture"
 	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/token"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -67,11 +71,11 @@ hello, world
 	f, ok := stmt.Expression.(*ast.CmdLiteral)
 	assert.True(t, ok)
 	assert.Equal(t, "example", f.FuncName.Value)
-	assert.Equal(t, "value1", f.Parameters.Map["a"])
-	assert.Equal(t, "value2", f.Parameters.Map["b"])
-	assert.Equal(t, "test.png", f.Parameters.Map["c"])
+	assert.Equal(t, "value1", f.Parameters.Get("a"))
+	assert.Equal(t, "value2", f.Parameters.Get("b"))
+	assert.Equal(t, "test.png", f.Parameters.Get("c"))
 
-	assert.Equal(t, "[example a=value1, b=value2, c=test.png]hello, world[r]hello, world", program.String())
+	assert.Equal(t, `[example a="value1" b="value2" c="test.png"]hello, world[r]hello, world`, program.String())
 }
 
 func TestParseText(t *testing.T) {
@@ -110,7 +114,7 @@ func TestParseCmdExpression_シンタックスエラーを捕捉できる(t *tes
 		assert.Error(t, err)
 
 		assert.Equal(t, 1, len(p.Errors()))
-		assert.Contains(t, p.Errors()[0], "STRINGがない")
+		assert.Contains(t, p.Errors()[0], "値がない")
 	}
 	{
 		input := `[example a="hello"`
@@ -123,6 +127,18 @@ func TestParseCmdExpression_シンタックスエラーを捕捉できる(t *tes
 		assert.Equal(t, 1, len(p.Errors()))
 		assert.Contains(t, p.Errors()[0], "対応する右ブラケットが存在しなかったため、末尾まで到達した")
 	}
+	{
+		input := "本文\n[p]\xff"
+
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		_, err := p.ParseProgram()
+		assert.Error(t, err)
+
+		assert.Equal(t, 1, len(p.Errors()))
+		assert.Equal(t, `2:4: 不正なトークン: "\xff"`, p.Errors()[0])
+		assert.Equal(t, []Error{{Pos: token.Position{Offset: 10, Line: 2, Column: 4}, Msg: `不正なトークン: "\xff"`}}, p.ErrorList())
+	}
 }
 
 func TestParseLabelExpression(t *testing.T) {
@@ -200,3 +216,153 @@ func TestParseLabelExpression(t *testing.T) {
 		}
 	}
 }
+
+func TestParseComment_直後の文に紐づける(t *testing.T) {
+	input := `; ファイル先頭
+*start
+; 本文の前
+あいう[p]
+/* ラベルの前 */
+*ch1
+えお
+; 末尾`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program, err := p.ParseProgram()
+	assert.NoError(t, err)
+
+	{
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		assert.True(t, ok)
+		assert.Equal(t, 1, len(stmt.Comments))
+		assert.Equal(t, "ファイル先頭", stmt.Comments[0].Text)
+
+		label, ok := stmt.Expression.(*ast.LabelLiteral)
+		assert.True(t, ok)
+		body, ok := label.Body.Statements[0].(*ast.ExpressionStatement)
+		assert.True(t, ok)
+		assert.Equal(t, 1, len(body.Comments))
+		assert.Equal(t, "本文の前", body.Comments[0].Text)
+		assert.Equal(t, "; 本文の前", body.Comments[0].String())
+	}
+	{
+		stmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+		assert.True(t, ok)
+		assert.Equal(t, 1, len(stmt.Comments))
+		assert.Equal(t, "ラベルの前", stmt.Comments[0].Text)
+	}
+	assert.Equal(t, 1, len(program.Comments))
+	assert.Equal(t, "末尾", program.Comments[0].Text)
+
+	// コメントは文字列表現に含まれない
+	assert.Equal(t, "*start\nあいう[p]*ch1\nえお", program.String())
+}
+
+func TestParseCmdExpression_型つきの値をパースできる(t *testing.T) {
+	input := `[example a="str" b='single' c=500 d=1.5 e=ident]`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program, err := p.ParseProgram()
+	assert.NoError(t, err)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	assert.True(t, ok)
+	f, ok := stmt.Expression.(*ast.CmdLiteral)
+	assert.True(t, ok)
+
+	{
+		v, ok := f.Parameters.Map["a"].(*ast.StringLiteral)
+		assert.True(t, ok)
+		assert.Equal(t, "str", v.Value)
+	}
+	{
+		v, ok := f.Parameters.Map["b"].(*ast.StringLiteral)
+		assert.True(t, ok)
+		assert.Equal(t, "single", v.Value)
+	}
+	{
+		v, ok := f.Parameters.Map["c"].(*ast.IntegerLiteral)
+		assert.True(t, ok)
+		assert.Equal(t, int64(500), v.Value)
+	}
+	{
+		v, ok := f.Parameters.Map["d"].(*ast.FloatLiteral)
+		assert.True(t, ok)
+		assert.Equal(t, 1.5, v.Value)
+	}
+	{
+		v, ok := f.Parameters.Map["e"].(*ast.Identifier)
+		assert.True(t, ok)
+		assert.Equal(t, "ident", v.Value)
+	}
+	assert.Equal(t, "500", f.Parameters.Get("c"))
+	assert.Equal(t, "", f.Parameters.Get("not exists"))
+	assert.Equal(t, `[example a="str" b="single" c=500 d=1.5 e=ident]`, f.String())
+}
+
+func TestNext_文を1つずつ返す(t *testing.T) {
+	input := `*start
+本文[p]
+*第一章
+[jump target=start]`
+
+	p := NewParser(lexer.NewLexer(input))
+
+	stmt, err := p.Next()
+	assert.NoError(t, err)
+	label := stmt.(*ast.ExpressionStatement).Expression.(*ast.LabelLiteral)
+	assert.Equal(t, "start", label.LabelName.Value)
+	assert.Equal(t, "本文[p]", label.Body.String())
+
+	stmt, err = p.Next()
+	assert.NoError(t, err)
+	label = stmt.(*ast.ExpressionStatement).Expression.(*ast.LabelLiteral)
+	assert.Equal(t, "第一章", label.LabelName.Value)
+	assert.Equal(t, "[jump target=start]", label.Body.String())
+
+	_, err = p.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNext_エラーの後も続けられる(t *testing.T) {
+	input := "[example a]\n本文"
+
+	p := NewParser(lexer.NewLexer(input))
+
+	stmt, err := p.Next()
+	assert.ErrorContains(t, err, "1:10: シンタックスエラー: EQUALがない")
+	assert.Equal(t, "[example]", stmt.String())
+
+	var texts []string
+	for {
+		stmt, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		texts = append(texts, stmt.String())
+	}
+	assert.Contains(t, texts, "本文")
+}
+
+func BenchmarkParser(b *testing.B) {
+	input := fixture.LargeScenario(1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p := NewParser(lexer.NewLexerFromReader(strings.NewReader(input)))
+		for {
+			_, err := p.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//go:build js || windows || darwin || ebiten
+
+package renderer
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/kijimaD/nova/asset"
+	"github.com/kijimaD/nova/event"
+)
+
+// フォントファイルを読み込む
+func LoadFont(fsys fs.FS, path string) (*text.GoTextFaceSource, error) {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return text.NewGoTextFaceSource(bytes.NewReader(b))
+}
+
+// PNGかJPEGの画像を読み込む
+func LoadImage(fsys fs.FS, path string) (*ebiten.Image, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return ebiten.NewImageFromImage(img), nil
+}
+
+// シナリオが参照しているすべての画像を読み込み、パスで引けるようにする
+// 素材が見つからないときは、ゲームの途中ではなく起動時にエラーにする
+func LoadImages(fsys fs.FS, e *event.Evaluator) (map[string]*ebiten.Image, error) {
+	manifest, err := asset.Collect(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := manifest.Verify(fsys); err != nil {
+		return nil, err
+	}
+
+	images := map[string]*ebiten.Image{}
+	for _, path := range manifest.Paths() {
+		img, err := LoadImage(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		images[path] = img
+	}
+
+	return images, nil
+}
@@ -0,0 +1,7 @@
+// Ebitengineでキューを表示するためのパッケージ
+// キューをebiten.Gameとして包み、背景、立ち絵、メッセージウィンドウ、名前欄、クリック待ちの表示、選択肢、キー操作を受け持つ
+// アプリはフォントと素材とシナリオを用意するだけでよい
+//
+// Ebitengineを使うファイルは、Linuxなどではcgoとウィンドウシステムのヘッダーがないとビルドできない
+// そのため、js、windows、darwin以外では-tags ebitenを指定したときだけビルドする。配置の計算などはタグなしでもビルドしてテストする
+package renderer
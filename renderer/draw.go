@@ -0,0 +1,174 @@
+//go:build js || windows || darwin || ebiten
+
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/kijimaD/nova/event"
+)
+
+// 斜体で傾ける量
+const italicSkew = -0.2
+
+func (g *Game) Draw(screen *ebiten.Image) {
+	l := g.opts.Layout
+	screen.Fill(l.BackgroundColor)
+	if g.bg != nil {
+		drawContain(screen, g.bg)
+	}
+	for _, s := range g.sprites {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(s.X, s.Y)
+		screen.DrawImage(s.Image, op)
+	}
+	if g.hidden {
+		return
+	}
+
+	lines := g.q.Lines()
+	name := ""
+	if !l.NameBox.Empty() {
+		name, lines = SplitName(lines)
+	}
+	fillRect(screen, l.Window, l.WindowColor)
+	if name != "" {
+		fillRect(screen, l.NameBox, l.NameBoxColor)
+		g.drawRun(screen, event.Run{Text: name}, float64(l.NameBox.Min.X+l.Padding), g.centerBaseline(float64(l.NameBox.Min.Y), float64(l.NameBox.Dy())))
+	}
+	y := float64(l.Window.Min.Y + l.Padding)
+	for _, line := range lines {
+		x := float64(l.Window.Min.X + l.Padding)
+		baseline := g.lineBaseline(y)
+		for _, run := range line {
+			x += g.drawRun(screen, run, x, baseline)
+		}
+		y += l.LineSpacing
+	}
+
+	if g.selecting() {
+		g.drawChoices(screen)
+		return
+	}
+	if g.waitingClick() {
+		g.drawPrompt(screen)
+	}
+}
+
+// 本文の1行を書くときのベースラインを返す。行の下に寄せ、上の余白にはルビを書く
+func (g *Game) lineBaseline(top float64) float64 {
+	return top + g.opts.Layout.LineSpacing - g.face(0).Metrics().HDescent
+}
+
+// 高さheightの帯の中央に、本文の文字サイズで書くときのベースラインを返す
+func (g *Game) centerBaseline(top float64, height float64) float64 {
+	m := g.face(0).Metrics()
+	return top + (height-m.HAscent-m.HDescent)/2 + m.HAscent
+}
+
+// 装飾に合わせて文字列を書き、その幅を返す
+func (g *Game) drawRun(dst *ebiten.Image, run event.Run, x float64, baseline float64) float64 {
+	face := g.face(run.Style.Size)
+	m := face.Metrics()
+	top := baseline - m.HAscent
+	width := text.Advance(run.Text, face)
+	clr := parseColor(run.Style.Color, g.opts.Layout.TextColor)
+
+	offsets := []float64{0}
+	if run.Style.Bold {
+		// 1ピクセルずらして重ねて太く見せる
+		offsets = append(offsets, 1)
+	}
+	for _, dx := range offsets {
+		op := &text.DrawOptions{}
+		if run.Style.Italic {
+			op.GeoM.Translate(0, -m.HAscent)
+			op.GeoM.Skew(italicSkew, 0)
+			op.GeoM.Translate(0, m.HAscent)
+		}
+		op.GeoM.Translate(x+dx, top)
+		op.ColorScale.ScaleWithColor(clr)
+		text.Draw(dst, run.Text, face, op)
+	}
+
+	if run.Style.Emphasis {
+		// 1文字ごとに、上に傍点を打つ
+		cx := x
+		for _, r := range run.Text {
+			w := text.Advance(string(r), face)
+			vector.DrawFilledCircle(dst, float32(cx+w/2), float32(top-3), float32(face.Size/12+1), clr, true)
+			cx += w
+		}
+	}
+	if run.Ruby != "" {
+		rubyFace := g.face(g.opts.Layout.RubySize)
+		rm := rubyFace.Metrics()
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(x+(width-text.Advance(run.Ruby, rubyFace))/2, top-rm.HAscent-rm.HDescent)
+		op.ColorScale.ScaleWithColor(clr)
+		text.Draw(dst, run.Ruby, rubyFace, op)
+	}
+
+	return width
+}
+
+func (g *Game) drawChoices(dst *ebiten.Image) {
+	l := g.opts.Layout
+	choices := g.q.Choices()
+	x, y := ebiten.CursorPosition()
+	cursor := image.Pt(x, y)
+	for i, r := range l.choiceRects(len(choices)) {
+		clr := l.ChoiceColor
+		if cursor.In(r) {
+			clr = l.ChoiceHoverColor
+		}
+		fillRect(dst, r, clr)
+		face := g.face(0)
+		op := &text.DrawOptions{}
+		op.GeoM.Translate(float64(r.Min.X+r.Dx()/2), float64(r.Min.Y+r.Dy()/2))
+		op.PrimaryAlign = text.AlignCenter
+		op.SecondaryAlign = text.AlignCenter
+		op.ColorScale.ScaleWithColor(l.TextColor)
+		text.Draw(dst, choices[i].Text, face, op)
+	}
+}
+
+// クリック待ちの記号を、メッセージウィンドウの右下で上下に揺らして表示する
+func (g *Game) drawPrompt(dst *ebiten.Image) {
+	l := g.opts.Layout
+	elapsed := time.Since(g.start).Seconds()
+	offsetY := 4 * math.Sin(elapsed*4)
+	right := float64(l.Window.Max.X - l.Padding)
+	bottom := float64(l.Window.Max.Y-l.Padding) + offsetY
+	if g.opts.Prompt == nil {
+		r := l.FontSize / 4
+		vector.DrawFilledCircle(dst, float32(right-r), float32(bottom-r), float32(r), l.TextColor, true)
+		return
+	}
+	b := g.opts.Prompt.Bounds()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(right-float64(b.Dx()), bottom-float64(b.Dy()))
+	dst.DrawImage(g.opts.Prompt, op)
+}
+
+// 縦横比を保ったまま、画面に収まるように中央に描く
+func drawContain(dst *ebiten.Image, img *ebiten.Image) {
+	db := dst.Bounds()
+	sb := img.Bounds()
+	scale := math.Min(float64(db.Dx())/float64(sb.Dx()), float64(db.Dy())/float64(sb.Dy()))
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((float64(db.Dx())-float64(sb.Dx())*scale)/2, (float64(db.Dy())-float64(sb.Dy())*scale)/2)
+	op.Filter = ebiten.FilterLinear
+	dst.DrawImage(img, op)
+}
+
+func fillRect(dst *ebiten.Image, r image.Rectangle, clr color.Color) {
+	vector.DrawFilledRect(dst, float32(r.Min.X), float32(r.Min.Y), float32(r.Dx()), float32(r.Dy()), clr, false)
+}
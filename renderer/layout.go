@@ -0,0 +1,84 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+)
+
+// 画面の配置と色
+type Layout struct {
+	// 論理的な画面の大きさ。ウィンドウの大きさにかかわらず、この大きさで描画する
+	ScreenWidth  int
+	ScreenHeight int
+	// 背景画像がないときに塗る色
+	BackgroundColor color.Color
+
+	// メッセージウィンドウの位置と大きさ
+	Window      image.Rectangle
+	WindowColor color.Color
+	// メッセージウィンドウの内側の余白。本文はこの内側で折り返す
+	Padding int
+
+	// 名前欄の位置と大きさ。空のときは名前欄を表示せず、【名前】も本文として表示する
+	NameBox      image.Rectangle
+	NameBoxColor color.Color
+
+	// 本文の文字サイズ。[font size]で変えたときは、そちらを使う
+	FontSize float64
+	// ルビの文字サイズ
+	RubySize float64
+	// 行の間隔。ルビを書けるように、文字サイズより広めにとる
+	LineSpacing float64
+	// 本文の色。[font color]で変えたときは、そちらを使う
+	TextColor color.Color
+
+	// 選択肢の大きさと間隔。画面の中央に縦に並べる
+	ChoiceWidth  int
+	ChoiceHeight int
+	ChoiceGap    int
+	ChoiceColor  color.Color
+	// カーソルが重なっている選択肢の色
+	ChoiceHoverColor color.Color
+}
+
+// 720x720の画面の下部に、メッセージウィンドウと名前欄を置く
+func DefaultLayout() Layout {
+	return Layout{
+		ScreenWidth:      720,
+		ScreenHeight:     720,
+		BackgroundColor:  color.Black,
+		Window:           image.Rect(20, 460, 700, 700),
+		WindowColor:      color.RGBA{0x00, 0x00, 0x00, 0xb0},
+		Padding:          24,
+		NameBox:          image.Rect(20, 412, 220, 452),
+		NameBoxColor:     color.RGBA{0x20, 0x20, 0x40, 0xd0},
+		FontSize:         26,
+		RubySize:         12,
+		LineSpacing:      44,
+		TextColor:        color.White,
+		ChoiceWidth:      480,
+		ChoiceHeight:     48,
+		ChoiceGap:        16,
+		ChoiceColor:      color.RGBA{0x00, 0x00, 0x00, 0xc0},
+		ChoiceHoverColor: color.RGBA{0x40, 0x40, 0x80, 0xe0},
+	}
+}
+
+// 本文を書ける幅
+func (l Layout) lineWidth() float64 {
+	return float64(l.Window.Dx() - l.Padding*2)
+}
+
+// n個の選択肢を置く位置を返す
+func (l Layout) choiceRects(n int) []image.Rectangle {
+	result := make([]image.Rectangle, n)
+	total := n*l.ChoiceHeight + (n-1)*l.ChoiceGap
+	x := (l.ScreenWidth - l.ChoiceWidth) / 2
+	y := (l.ScreenHeight - total) / 2
+	for i := range result {
+		top := y + i*(l.ChoiceHeight+l.ChoiceGap)
+		result[i] = image.Rect(x, top, x+l.ChoiceWidth, top+l.ChoiceHeight)
+	}
+
+	return result
+}
@@ -0,0 +1,79 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineWidth_余白を除いた幅を返す(t *testing.T) {
+	l := DefaultLayout()
+
+	assert.Equal(t, float64(680-24*2), l.lineWidth())
+}
+
+func TestChoiceRects_画面の中央に縦に並べる(t *testing.T) {
+	l := DefaultLayout()
+
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(120, 272, 600, 320),
+		image.Rect(120, 336, 600, 384),
+		image.Rect(120, 400, 600, 448),
+	}, l.choiceRects(3))
+	assert.Equal(t, []image.Rectangle{image.Rect(120, 336, 600, 384)}, l.choiceRects(1))
+	assert.Empty(t, l.choiceRects(0))
+}
+
+func TestSplitName_先頭の名前を取り出す(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []event.Line
+		expectName string
+		expect     []event.Line
+	}{
+		{
+			"名前と本文",
+			[]event.Line{{{Text: "【太郎】こんにちは"}}, {{Text: "次の行"}}},
+			"太郎",
+			[]event.Line{{{Text: "こんにちは"}}, {{Text: "次の行"}}},
+		},
+		{
+			"名前だけの行",
+			[]event.Line{{{Text: "【太郎】"}, {Text: "赤", Style: event.Style{Color: "#ff0000"}}}},
+			"太郎",
+			[]event.Line{{{Text: "赤", Style: event.Style{Color: "#ff0000"}}}},
+		},
+		{
+			"名前がない",
+			[]event.Line{{{Text: "こんにちは"}}},
+			"",
+			[]event.Line{{{Text: "こんにちは"}}},
+		},
+		{
+			"閉じていない",
+			[]event.Line{{{Text: "【太郎"}}},
+			"",
+			[]event.Line{{{Text: "【太郎"}}},
+		},
+		{"空", []event.Line{}, "", []event.Line{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, lines := SplitName(tt.lines)
+			assert.Equal(t, tt.expectName, name)
+			assert.Equal(t, tt.expect, lines)
+		})
+	}
+}
+
+func TestParseColor_色を読む(t *testing.T) {
+	def := color.White
+
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0x00, B: 0x80, A: 0xff}, parseColor("#ff0080", def))
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0x00, B: 0x88, A: 0xff}, parseColor("#f08", def))
+	assert.Equal(t, def, parseColor("", def))
+	assert.Equal(t, def, parseColor("#xyz", def))
+}
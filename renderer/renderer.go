@@ -0,0 +1,300 @@
+//go:build js || windows || darwin || ebiten
+
+package renderer
+
+import (
+	"errors"
+	"image"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/kijimaD/nova/event"
+)
+
+// 自動送りで待つ時間のデフォルト
+const DefaultAutoDelay = 2 * time.Second
+
+// 選択肢を選ぶキー。先頭から1つ目、2つ目、...の選択肢に対応する
+var choiceKeys = []ebiten.Key{
+	ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3,
+	ebiten.KeyDigit4, ebiten.KeyDigit5, ebiten.KeyDigit6,
+	ebiten.KeyDigit7, ebiten.KeyDigit8, ebiten.KeyDigit9,
+}
+
+// 操作に割り当てるキー。どれかのキーを押せば操作する
+// 選択肢は数字キーの1から9か、クリックで選ぶ
+type KeyBindings struct {
+	// クリック待ちを進める。マウスの左クリックとタッチでも進める
+	Advance []ebiten.Key
+	// 押している間、選択肢か最後まで飛ばす
+	Skip []ebiten.Key
+	// 自動送りを切り替える
+	Auto []ebiten.Key
+	// メッセージウィンドウを隠す。もう一度押すか、クリックで戻す
+	Hide []ebiten.Key
+}
+
+func DefaultKeyBindings() KeyBindings {
+	return KeyBindings{
+		Advance: []ebiten.Key{ebiten.KeyEnter, ebiten.KeySpace},
+		Skip:    []ebiten.Key{ebiten.KeyControl},
+		Auto:    []ebiten.Key{ebiten.KeyA},
+		Hide:    []ebiten.Key{ebiten.KeyH},
+	}
+}
+
+type Options struct {
+	Layout Layout
+	Keys   KeyBindings
+	// 本文のフォント。必須。LoadFontで読み込める
+	Font *text.GoTextFaceSource
+	// シナリオで使う画像。パスで引く。LoadImagesで読み込める
+	Images map[string]*ebiten.Image
+	// 最初に表示する背景。nilのときはLayout.BackgroundColorで塗る
+	Background *ebiten.Image
+	// クリック待ちのときに表示する画像。nilのときは丸を表示する
+	Prompt *ebiten.Image
+	// 自動送りで、クリック待ちになってから進めるまでの時間
+	AutoDelay time.Duration
+	// 背景の変更以外の通知を受け取る。Updateから呼ぶので、立ち絵の変更などはここで行える
+	OnNotify func(e event.Event)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Layout:    DefaultLayout(),
+		Keys:      DefaultKeyBindings(),
+		Images:    map[string]*ebiten.Image{},
+		AutoDelay: DefaultAutoDelay,
+	}
+}
+
+// 背景の上、メッセージウィンドウの下に重ねる画像
+type Sprite struct {
+	Name  string
+	Image *ebiten.Image
+	// 画面上の左上の位置
+	X float64
+	Y float64
+}
+
+// キューを表示し、入力に応じて進める
+type Game struct {
+	q    *event.Queue
+	opts Options
+
+	// 文字サイズごとのフェイス
+	faces   map[float64]*text.GoTextFace
+	bg      *ebiten.Image
+	sprites []Sprite
+	start   time.Time
+	auto    bool
+	hidden  bool
+	// 自動送りで、クリック待ちになった時刻
+	waitSince time.Time
+}
+
+// キューの折り返しを、フォントの描画幅とメッセージウィンドウの幅に合わせる。Start()の前に呼ぶ
+func NewGame(q *event.Queue, opts Options) (*Game, error) {
+	if opts.Font == nil {
+		return nil, errors.New("フォントが指定されていない")
+	}
+	if opts.Images == nil {
+		opts.Images = map[string]*ebiten.Image{}
+	}
+	g := &Game{q: q, opts: opts, faces: map[float64]*text.GoTextFace{}, bg: opts.Background, sprites: []Sprite{}, start: time.Now()}
+
+	config := q.Config()
+	config.Measurer = faceMeasurer{face: g.face(0)}
+	config.LineWidth = opts.Layout.lineWidth()
+	q.SetConfig(config)
+
+	return g, nil
+}
+
+// ウィンドウを開き、キューを開始して、閉じられるまで続ける
+func (g *Game) Run(title string) error {
+	ebiten.SetWindowSize(g.opts.Layout.ScreenWidth, g.opts.Layout.ScreenHeight)
+	ebiten.SetWindowTitle(title)
+	g.q.Start()
+
+	return ebiten.RunGame(g)
+}
+
+// 立ち絵を表示する。同じ名前の立ち絵があれば、重なり順はそのままで置き換える
+// Updateと同じゴルーチンから呼ぶ
+func (g *Game) SetSprite(s Sprite) {
+	for i := range g.sprites {
+		if g.sprites[i].Name == s.Name {
+			g.sprites[i] = s
+			return
+		}
+	}
+	g.sprites = append(g.sprites, s)
+}
+
+// 立ち絵を消す
+func (g *Game) RemoveSprite(name string) {
+	for i := range g.sprites {
+		if g.sprites[i].Name == name {
+			g.sprites = append(g.sprites[:i], g.sprites[i+1:]...)
+			return
+		}
+	}
+}
+
+func (g *Game) Update() error {
+	g.notify()
+
+	keys := g.opts.Keys
+	pos, clicked := justClicked()
+	if justPressed(keys.Hide) {
+		g.hidden = !g.hidden
+		return nil
+	}
+	if g.hidden {
+		if clicked || justPressed(keys.Advance) {
+			g.hidden = false
+		}
+		return nil
+	}
+	if justPressed(keys.Auto) {
+		g.auto = !g.auto
+	}
+
+	if g.selecting() {
+		g.waitSince = time.Time{}
+		return g.updateChoices(pos, clicked)
+	}
+	switch {
+	case clicked || justPressed(keys.Advance) || pressed(keys.Skip):
+		g.waitSince = time.Time{}
+		g.q.Run()
+	case g.auto && g.waitingClick():
+		if g.waitSince.IsZero() {
+			g.waitSince = time.Now()
+		}
+		if time.Since(g.waitSince) >= g.opts.AutoDelay {
+			g.waitSince = time.Time{}
+			g.q.Run()
+		}
+	default:
+		g.waitSince = time.Time{}
+	}
+
+	return nil
+}
+
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return g.opts.Layout.ScreenWidth, g.opts.Layout.ScreenHeight
+}
+
+// たまっている通知をすべて処理する
+func (g *Game) notify() {
+	for len(g.q.NotifyChan) > 0 {
+		e := <-g.q.NotifyChan
+		switch e := e.(type) {
+		case *event.ChangeBg:
+			g.bg = g.opts.Images[e.Source]
+			continue
+		}
+		if g.opts.OnNotify != nil {
+			g.opts.OnNotify(e)
+		}
+	}
+}
+
+func (g *Game) updateChoices(pos image.Point, clicked bool) error {
+	choices := g.q.Choices()
+	for i, key := range choiceKeys {
+		if i < len(choices) && inpututil.IsKeyJustPressed(key) {
+			return g.q.Choose(i)
+		}
+	}
+	if !clicked {
+		return nil
+	}
+	for i, r := range g.opts.Layout.choiceRects(len(choices)) {
+		if pos.In(r) {
+			return g.q.Choose(i)
+		}
+	}
+
+	return nil
+}
+
+func (g *Game) selecting() bool {
+	_, ok := g.q.Head().(*event.Select)
+	return ok
+}
+
+// 本文を表示し終えて、クリックを待っているか
+func (g *Game) waitingClick() bool {
+	switch g.q.Head().(type) {
+	case *event.Flush, *event.LineEndWait:
+		return g.q.OnAnim.Load()
+	}
+
+	return false
+}
+
+// 文字サイズのフェイスを返す。0のときはLayout.FontSizeを使う
+func (g *Game) face(size float64) *text.GoTextFace {
+	if size == 0 {
+		size = g.opts.Layout.FontSize
+	}
+	if f, ok := g.faces[size]; ok {
+		return f
+	}
+	f := &text.GoTextFace{Source: g.opts.Font, Size: size, Language: language.Japanese}
+	g.faces[size] = f
+
+	return f
+}
+
+// フォントの描画幅で折り返すために使う
+type faceMeasurer struct {
+	face text.Face
+}
+
+func (m faceMeasurer) Advance(s string) float64 {
+	return text.Advance(s, m.face)
+}
+
+func justPressed(keys []ebiten.Key) bool {
+	for _, k := range keys {
+		if inpututil.IsKeyJustPressed(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func pressed(keys []ebiten.Key) bool {
+	for _, k := range keys {
+		if ebiten.IsKeyPressed(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// このフレームでクリックかタッチされていれば、その位置を返す
+func justClicked() (image.Point, bool) {
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		return image.Pt(x, y), true
+	}
+	if ids := inpututil.AppendJustPressedTouchIDs(nil); len(ids) > 0 {
+		x, y := ebiten.TouchPosition(ids[0])
+		return image.Pt(x, y), true
+	}
+
+	return image.Point{}, false
+}
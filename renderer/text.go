@@ -0,0 +1,52 @@
+package renderer
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/kijimaD/nova/event"
+)
+
+// 本文の先頭の【名前】を取り出し、残りの本文を返す。名前がないときは空文字列を返す
+func SplitName(lines []event.Line) (string, []event.Line) {
+	if len(lines) == 0 || len(lines[0]) == 0 {
+		return "", lines
+	}
+	first := lines[0][0]
+	if !strings.HasPrefix(first.Text, "【") {
+		return "", lines
+	}
+	end := strings.Index(first.Text, "】")
+	if end < 0 {
+		return "", lines
+	}
+	name := strings.TrimPrefix(first.Text[:end], "【")
+	first.Text = first.Text[end+len("】"):]
+
+	result := make([]event.Line, len(lines))
+	copy(result, lines)
+	result[0] = append(event.Line{first}, lines[0][1:]...)
+	if first.Text == "" {
+		result[0] = result[0][1:]
+	}
+
+	return name, result
+}
+
+// #rgbか#rrggbbの形式の色を読む。空や読めないときはデフォルトの色を返す
+func parseColor(s string, def color.Color) color.Color {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return def
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return def
+	}
+
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
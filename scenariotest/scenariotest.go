@@ -0,0 +1,130 @@
+// シナリオの回帰テストのためのヘルパーパッケージ
+// シナリオを画面なしで実行し、表示した本文やイベントの並びをゴールデンファイルと比較する
+// 期待する内容が変わったときは、Options.Updateを指定してゴールデンファイルを書き直す
+package scenariotest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kijimaD/nova/headless"
+	"github.com/kijimaD/nova/loader"
+)
+
+// シナリオファイルの拡張子
+const Ext = ".sce"
+
+// ゴールデンファイルの拡張子
+const GoldenExt = ".golden"
+
+// 実行の設定
+type Options struct {
+	// 選ぶ選択肢の番号。nilのときはすべてのルートを実行する
+	Choices []int
+	// 本文と通知に加えて、実行したすべてのイベントを記録する
+	Events bool
+	// 比較せずに、実行した記録でゴールデンファイルを書き直す
+	// 呼び出し側のテストで定義したフラグを渡す。例: Options{Update: *update}
+	Update bool
+}
+
+// シナリオを実行した記録を返す。ルートがエラーになったときも、それまでの記録を返す
+// 構文エラーや不正な値があるときは、実行せずにエラーを返す
+func Record(input string, opts Options) (string, error) {
+	e, err := loader.NewEvaluatorFromReader(strings.NewReader(input))
+	if err != nil {
+		return "", err
+	}
+	r := headless.NewRunner(e)
+	r.RecordEvents = opts.Events
+
+	if opts.Choices == nil {
+		ts, err := r.Explore()
+		return headless.FormatRoutes(ts), err
+	}
+	t, err := r.Run(opts.Choices)
+
+	return headless.FormatRoutes([]*headless.Transcript{t}), err
+}
+
+// シナリオを実行した記録を、ゴールデンファイルと比較する
+func Assert(t testing.TB, input string, golden string, opts Options) {
+	t.Helper()
+
+	got, err := Record(input, opts)
+	if err != nil {
+		t.Errorf("シナリオの実行に失敗した: %s", err)
+	}
+	if opts.Update {
+		if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("ゴールデンファイルを読み込めない。Options.Updateで作成する: %s", err)
+	}
+	if string(expect) != got {
+		t.Errorf("ゴールデンファイルと一致しない: %s\n%s", golden, diff(string(expect), got))
+	}
+}
+
+// 異なる行を、期待する内容は-、実際の内容は+をつけて並べる
+func diff(expect string, got string) string {
+	el := strings.Split(expect, "\n")
+	gl := strings.Split(got, "\n")
+	n := len(el)
+	if len(gl) > n {
+		n = len(gl)
+	}
+
+	var out strings.Builder
+	for i := 0; i < n; i++ {
+		var e, g string
+		if i < len(el) {
+			e = el[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if e == g {
+			continue
+		}
+		fmt.Fprintf(&out, "%d行目:\n- %s\n+ %s\n", i+1, e, g)
+	}
+
+	return out.String()
+}
+
+// シナリオファイルを実行した記録を、拡張子を.goldenに変えたファイルと比較する
+func AssertFile(t testing.TB, path string, opts Options) {
+	t.Helper()
+
+	input, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Assert(t, string(input), strings.TrimSuffix(path, Ext)+GoldenExt, opts)
+}
+
+// ディレクトリにあるすべてのシナリオファイルを、サブテストで比較する
+func AssertDir(t *testing.T, dir string, opts Options) {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+Ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("シナリオファイルがない: %s", dir)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			AssertFile(t, path, opts)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package scenariotest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "ゴールデンファイルを更新する")
+
+func TestAssertDir_ゴールデンファイルと一致する(t *testing.T) {
+	AssertDir(t, "testdata", Options{Update: *update})
+}
+
+func TestAssert_すべてのイベントを記録できる(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "linear.sce"))
+	assert.NoError(t, err)
+
+	Assert(t, string(input), filepath.Join("testdata", "linear_events.golden"), Options{Events: true, Update: *update})
+}
+
+func TestRecord_選択肢を指定できる(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "route.sce"))
+	assert.NoError(t, err)
+
+	got, err := Record(string(input), Options{Choices: []int{1, 1}})
+	assert.NoError(t, err)
+	assert.Contains(t, got, "== ルート [1 1]\n")
+	assert.NotContains(t, got, "*outside")
+}
+
+// 失敗を記録するだけのテスト
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = true
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.failed = true
+}
+
+func TestAssert_一致しないと失敗する(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "route.golden")
+	assert.NoError(t, os.WriteFile(golden, []byte("== ルート [0]\n(おわり)\n"), 0644))
+
+	r := &recorder{TB: t}
+	Assert(r, "*start\nあ[p]", golden, Options{})
+	assert.True(t, r.failed)
+}
+
+func TestAssert_実行に失敗すると失敗する(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "loop.golden")
+	got, _ := Record("*start\n[jump target=start]", Options{})
+	assert.NoError(t, os.WriteFile(golden, []byte(got), 0644))
+
+	r := &recorder{TB: t}
+	Assert(r, "*start\n[jump target=start]", golden, Options{})
+	assert.True(t, r.failed)
+}
+
+func TestRecord_不正な値はエラーになる(t *testing.T) {
+	_, err := Record("*start\n[wait time=abc]\nあ[p]", Options{})
+	assert.EqualError(t, err, `2:1: 不正な値: time: invalid duration "abcms"`)
+}
+
+func TestAssert_書き直す(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "new.golden")
+
+	Assert(t, "*start\nあ[p]", golden, Options{Update: true})
+	b, err := os.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, "== ルート []\n*start\n| あ\n\n(おわり)\n", string(b))
+}
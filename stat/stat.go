@@ -0,0 +1,149 @@
+// シナリオの統計を集計するパッケージ
+// 文字数、ページ数、使っている画像、読了時間の目安をラベルごとに数える
+package stat
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+)
+
+// 1分あたりに読む文字数のデフォルト
+const DefaultCharsPerMinute = 500
+
+// 集計した値
+type Stat struct {
+	// 本文の文字数。表示の折り返しと同じく、全角1文字を1、半角1文字を0.5として数える
+	Chars float64 `json:"chars"`
+	// ページ数。[p]の数
+	Pages int `json:"pages"`
+	// 背景に使っている画像。重複を除いて出現順に並べる
+	Images []string `json:"images"`
+	// イベント数
+	Events int `json:"events"`
+	// 読了時間の目安。秒で表す
+	ReadingSeconds float64 `json:"reading_seconds"`
+}
+
+// ラベルごとの集計
+type LabelStat struct {
+	Name string `json:"name"`
+	Stat
+}
+
+// ファイルごとの集計
+type Report struct {
+	File   string      `json:"file"`
+	Labels []LabelStat `json:"labels"`
+	Total  Stat        `json:"total"`
+}
+
+// 評価器に登録されているすべてのラベルを集計する
+// charsPerMinuteは読了時間の計算に使う、1分あたりに読む文字数
+func Collect(e *event.Evaluator, charsPerMinute float64) (*Report, error) {
+	labels, err := e.CompileAll()
+	if err != nil {
+		return nil, err
+	}
+	measurer := event.FixedWidthMeasurer{Size: 1}
+
+	r := &Report{Labels: []LabelStat{}, Total: Stat{Images: []string{}}}
+	for _, label := range labels {
+		s := LabelStat{Name: label.Name, Stat: Stat{Images: []string{}}}
+		for _, eve := range label.Events {
+			switch eve := eve.(type) {
+			case *event.MsgEmit:
+				s.Chars += measurer.Advance(eve.Body)
+			case *event.Flush:
+				s.Pages++
+			case *event.ChangeBg:
+				s.Images = appendUnique(s.Images, eve.Source)
+			}
+		}
+		s.Events = len(label.Events)
+		s.ReadingSeconds = readingSeconds(s.Chars, charsPerMinute)
+		r.Labels = append(r.Labels, s)
+
+		r.Total.Chars += s.Chars
+		r.Total.Pages += s.Pages
+		r.Total.Events += s.Events
+		for _, img := range s.Images {
+			r.Total.Images = appendUnique(r.Total.Images, img)
+		}
+	}
+	r.Total.ReadingSeconds = readingSeconds(r.Total.Chars, charsPerMinute)
+
+	return r, nil
+}
+
+func readingSeconds(chars float64, charsPerMinute float64) float64 {
+	if charsPerMinute <= 0 {
+		return 0
+	}
+
+	return chars / charsPerMinute * 60
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
+
+// 表形式で書き込む
+// 日本語の見出しやラベル名でも揃うように、表示幅で桁を揃える
+func (r *Report) WriteTable(w io.Writer) error {
+	rows := [][]string{{r.File, "文字数", "ページ", "画像", "イベント", "読了目安"}}
+	for _, l := range r.Labels {
+		rows = append(rows, row(l.Name, l.Stat))
+	}
+	rows = append(rows, row("合計", r.Total))
+
+	// 表示幅。全角を2、半角を1とする
+	measurer := event.FixedWidthMeasurer{Size: 2}
+	widths := make([]int, len(rows[0]))
+	for _, cells := range rows {
+		for i, c := range cells {
+			if n := int(measurer.Advance(c)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var out strings.Builder
+	for _, cells := range rows {
+		for i, c := range cells {
+			pad := strings.Repeat(" ", widths[i]-int(measurer.Advance(c)))
+			// ラベル名は左寄せ、数値は右寄せにする
+			if i == 0 {
+				out.WriteString(c + pad)
+			} else {
+				out.WriteString("  " + pad + c)
+			}
+		}
+		out.WriteString("\n")
+	}
+	_, err := io.WriteString(w, out.String())
+
+	return err
+}
+
+func row(name string, s Stat) []string {
+	d := time.Duration(s.ReadingSeconds * float64(time.Second)).Round(time.Second)
+
+	return []string{
+		name,
+		strconv.FormatFloat(s.Chars, 'f', -1, 64),
+		strconv.Itoa(s.Pages),
+		strconv.Itoa(len(s.Images)),
+		strconv.Itoa(s.Events),
+		d.String(),
+	}
+}
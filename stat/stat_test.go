@@ -0,0 +1,59 @@
+package stat
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kijimaD/nova/event"
+	"github.com/kijimaD/nova/lexer"
+	"github.com/kijimaD/nova/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func collect(t *testing.T, input string) *Report {
+	t.Helper()
+
+	program, err := parser.NewParser(lexer.NewLexer(input)).ParseProgram()
+	assert.NoError(t, err)
+	e := event.NewEvaluator()
+	e.Eval(program)
+	r, err := Collect(e, 60)
+	assert.NoError(t, err)
+
+	return r
+}
+
+func TestCollect(t *testing.T) {
+	r := collect(t, `*start
+[image source="bg1.png"]
+あいう[l]えお[p]
+abcd[p]
+[image source="bg2.png"]
+[image source="bg1.png"]
+[jump target=ch1]
+*ch1
+[ruby text="かんじ"]漢字[endruby][p]`)
+
+	assert.Equal(t, []LabelStat{
+		{Name: "start", Stat: Stat{Chars: 7, Pages: 2, Images: []string{"bg1.png", "bg2.png"}, Events: 10, ReadingSeconds: 7}},
+		{Name: "ch1", Stat: Stat{Chars: 2, Pages: 1, Images: []string{}, Events: 4, ReadingSeconds: 2}},
+	}, r.Labels)
+	assert.Equal(t, Stat{Chars: 9, Pages: 3, Images: []string{"bg1.png", "bg2.png"}, Events: 14, ReadingSeconds: 9}, r.Total)
+}
+
+func TestWriteTable(t *testing.T) {
+	r := collect(t, `*start
+abcd[p]
+*ch1
+あいう[p]`)
+	r.File = "input.sce"
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.WriteTable(&buf))
+	expect := `input.sce  文字数  ページ  画像  イベント  読了目安
+start           2       1     0         2        2s
+ch1             3       1     0         2        3s
+合計            5       2     0         4        5s
+`
+	assert.Equal(t, expect, buf.String())
+}
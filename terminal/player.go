@@ -0,0 +1,231 @@
+// 端末でシナリオを遊ぶためのパッケージ
+// GPUやウィンドウのない環境でも、SSH越しに読み合わせできるようにする
+// 端末の特殊なモードを使わず、1行ずつ入力を受け付ける
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kijimaD/nova/event"
+)
+
+const (
+	// 折り返す幅のデフォルト。半角1文字を1として数える
+	DefaultWidth = 80
+	// 自動送りで待つ時間のデフォルト
+	DefaultAutoDelay = 2 * time.Second
+	// バックログに残すページ数
+	backlogSize = 100
+	// バックログで表示するページ数
+	backlogShow = 10
+)
+
+const help = `Enter: 進む
+s: 選択肢か最後まで飛ばす
+a: 自動送りを切り替える
+b: バックログを表示する
+数字: 選択肢を選ぶ
+q: 終了する
+h: この一覧を表示する`
+
+// キューを端末に表示し、入力に応じて進める
+type Player struct {
+	q   *event.Queue
+	in  io.Reader
+	out io.Writer
+	// 折り返す幅。全角1文字を2として数える
+	Width int
+	// 自動送りで、クリック待ちになってから進めるまでの時間
+	AutoDelay time.Duration
+
+	// 表示済みの文字列。ページが変わるとリセットする
+	printed string
+	// 最後に表示した文字列が、改行で終わっていなかったので改行を足したか
+	padded bool
+	// ページが変わってから、まだ本文を表示していないか
+	newPage bool
+	// 読み終わったページ
+	backlog []string
+	skip    bool
+	auto    bool
+}
+
+func NewPlayer(q *event.Queue, in io.Reader, out io.Writer) *Player {
+	return &Player{q: q, in: in, out: out, Width: DefaultWidth, AutoDelay: DefaultAutoDelay, backlog: []string{}}
+}
+
+// 最後まで遊ぶか、終了の入力か、入力の終わりまで続ける
+func (p *Player) Run() error {
+	config := p.q.Config()
+	config.Instant = true
+	config.Measurer = event.FixedWidthMeasurer{Size: 2}
+	config.LineWidth = float64(p.Width)
+	p.q.SetConfig(config)
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(p.in)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	fmt.Fprintln(p.out, "Enterで進む。hで操作の一覧を表示する")
+	p.q.Start()
+	defer p.q.Stop()
+	for {
+		p.q.Wait()
+		p.show()
+		if p.q.Ended() {
+			fmt.Fprintln(p.out, "(おわり)")
+			return nil
+		}
+		_, selecting := p.q.Head().(*event.Select)
+		if selecting {
+			p.skip = false
+			p.showChoices()
+		}
+		if p.skip {
+			p.q.Run()
+			continue
+		}
+
+		var line string
+		var ok bool
+		if p.auto && !selecting {
+			select {
+			case line, ok = <-lines:
+			case <-time.After(p.AutoDelay):
+				p.q.Run()
+				continue
+			}
+		} else {
+			line, ok = <-lines
+		}
+		if !ok {
+			return nil
+		}
+		if quit := p.handle(strings.TrimSpace(line), selecting); quit {
+			return nil
+		}
+	}
+}
+
+// 入力を処理する。終了するときはtrueを返す
+func (p *Player) handle(input string, selecting bool) bool {
+	switch input {
+	case "":
+		if selecting {
+			fmt.Fprintln(p.out, "選択肢の番号を入力する")
+			return false
+		}
+		p.q.Run()
+	case "s":
+		p.skip = true
+		if !selecting {
+			p.q.Run()
+		}
+	case "a":
+		p.auto = !p.auto
+		if p.auto {
+			fmt.Fprintln(p.out, "[自動送り: オン]")
+		} else {
+			fmt.Fprintln(p.out, "[自動送り: オフ]")
+		}
+	case "b":
+		p.showBacklog()
+	case "q":
+		return true
+	case "h", "?":
+		fmt.Fprintln(p.out, help)
+	default:
+		n, err := strconv.Atoi(input)
+		if err != nil || !selecting {
+			fmt.Fprintf(p.out, "不明な入力: %s\n", input)
+			return false
+		}
+		if err := p.q.Choose(n - 1); err != nil {
+			fmt.Fprintln(p.out, err)
+		}
+	}
+
+	return false
+}
+
+// 通知と、前回から増えた本文を表示する
+func (p *Player) show() {
+	for len(p.q.NotifyChan) > 0 {
+		fmt.Fprintln(p.out, status(<-p.q.NotifyChan))
+	}
+
+	display := p.q.Display()
+	text := strings.TrimPrefix(display, p.printed)
+	if !strings.HasPrefix(display, p.printed) {
+		// ページが変わった
+		p.pushBacklog(p.printed)
+		p.newPage = true
+		text = display
+		p.padded = false
+	}
+	p.printed = display
+	if text == "" {
+		return
+	}
+	if p.newPage {
+		fmt.Fprintln(p.out, "――――")
+		p.newPage = false
+	}
+	if p.padded {
+		text = strings.TrimPrefix(text, "\n")
+	}
+	fmt.Fprint(p.out, text)
+	p.padded = !strings.HasSuffix(text, "\n")
+	if p.padded {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *Player) showChoices() {
+	for i, c := range p.q.Choices() {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, c.Text)
+	}
+}
+
+func (p *Player) pushBacklog(page string) {
+	if page == "" {
+		return
+	}
+	p.backlog = append(p.backlog, page)
+	if len(p.backlog) > backlogSize {
+		p.backlog = p.backlog[len(p.backlog)-backlogSize:]
+	}
+}
+
+func (p *Player) showBacklog() {
+	fmt.Fprintln(p.out, "== バックログ ==")
+	pages := p.backlog
+	if len(pages) > backlogShow {
+		pages = pages[len(pages)-backlogShow:]
+	}
+	for _, page := range pages {
+		fmt.Fprintln(p.out, strings.TrimSuffix(page, "\n"))
+		fmt.Fprintln(p.out, "――――")
+	}
+	fmt.Fprintln(p.out, "== ここまで ==")
+}
+
+// クライアント側で表示する変化を、状態行にする
+func status(e event.Event) string {
+	switch e := e.(type) {
+	case *event.ChangeBg:
+		return fmt.Sprintf("[背景: %s]", e.Source)
+	}
+
+	return fmt.Sprintf("[%s]", e.String())
+}
@@ -0,0 +1,117 @@
+package terminal
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kijimaD/nova/loader"
+	"github.com/stretchr/testify/assert"
+)
+
+func play(t *testing.T, input string, keys string) string {
+	t.Helper()
+
+	q, err := loader.NewQueueFromText(input)
+	assert.NoError(t, err)
+	out := &bytes.Buffer{}
+	p := NewPlayer(q, strings.NewReader(keys), out)
+	p.Width = 10
+	assert.NoError(t, p.Run())
+
+	return out.String()
+}
+
+const input = `*start
+[image source="bg.png"]
+あいうえおかきくけこさしすせそ[l]
+たちつ[p]
+どこへ行く？
+[choice text="右" target=right]
+[choice text="左" target=left]
+[select]
+*right
+みぎ[p]
+*left
+ひだり[p]
+`
+
+func TestPlayer_入力にあわせて進める(t *testing.T) {
+	out := play(t, input, "\n\n\n2\n\n")
+
+	assert.Equal(t, `Enterで進む。hで操作の一覧を表示する
+[背景: bg.png]
+あいうえお
+かきくけこ
+さしすせそ
+たちつ
+――――
+どこへ行
+く？
+  1) 右
+  2) 左
+選択肢の番号を入力する
+  1) 右
+  2) 左
+ひだり
+(おわり)
+`, out)
+}
+
+func TestPlayer_選択肢まで飛ばしてバックログを表示する(t *testing.T) {
+	out := play(t, input, "s\nb\n1\nq\n")
+
+	assert.Equal(t, `Enterで進む。hで操作の一覧を表示する
+[背景: bg.png]
+あいうえお
+かきくけこ
+さしすせそ
+たちつ
+――――
+どこへ行
+く？
+  1) 右
+  2) 左
+== バックログ ==
+あいうえお
+かきくけこ
+さしすせそ
+たちつ
+――――
+== ここまで ==
+  1) 右
+  2) 左
+みぎ
+`, out)
+}
+
+func TestPlayer_不明な入力を知らせる(t *testing.T) {
+	out := play(t, input, "x\n9\nq\n")
+
+	assert.Contains(t, out, "不明な入力: x\n")
+	assert.Contains(t, out, "不明な入力: 9\n")
+}
+
+func TestPlayer_自動で送る(t *testing.T) {
+	q, err := loader.NewQueueFromText("*start\nあ[p]\nい[p]\n")
+	assert.NoError(t, err)
+	r, w := io.Pipe()
+	defer w.Close()
+	out := &bytes.Buffer{}
+	p := NewPlayer(q, r, out)
+	p.AutoDelay = time.Millisecond
+	done := make(chan error)
+	go func() { done <- p.Run() }()
+	_, err = w.Write([]byte("a\n"))
+	assert.NoError(t, err)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("最後まで進まなかった")
+	}
+	assert.Equal(t, "Enterで進む。hで操作の一覧を表示する\nあ\n[自動送り: オン]\n――――\nい\n(おわり)\n", out.String())
+}
@@ -1,10 +1,24 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // トークンの先頭の位置
+}
+
+// ソース上の位置
+type Position struct {
+	Offset int // 先頭からのバイト数。0始まり
+	Line   int // 行番号。1始まり
+	Column int // 行頭からの文字数。1始まり
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -12,9 +26,12 @@ const (
 	EOF     = "EOF"
 
 	// 識別子 + リテラル。数値や変数名など、予約語ではないもの。
-	STRING = "STRING"
-	IDENT  = "IDENT"
-	TEXT   = "TEXT"
+	STRING  = "STRING"
+	INT     = "INT"
+	FLOAT   = "FLOAT"
+	IDENT   = "IDENT"
+	TEXT    = "TEXT"
+	COMMENT = "COMMENT"
 
 	LBRACKET = "["
 	RBRACKET = "]"
@@ -29,6 +46,13 @@ const (
 	CMD_IMAGE         = "image"
 	CMD_WAIT          = "wait"
 	CMD_JUMP          = "jump"
+	CMD_DELAY         = "delay"
+	CMD_FONT          = "font"
+	CMD_RESET_FONT    = "resetfont"
+	CMD_RUBY          = "ruby"
+	CMD_END_RUBY      = "endruby"
+	CMD_CHOICE        = "choice"
+	CMD_SELECT        = "select"
 )
 
 // 予約語